@@ -0,0 +1,366 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"data-check-all/model"
+	"data-check-all/redact"
+	"data-check-all/report"
+	"data-check-all/server"
+	"data-check-all/service"
+	"errors"
+	"flag"
+	"fmt"
+	"go.yaml.in/yaml/v4"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+// targetFlags are the flags shared by every command that works on targets.
+type targetFlags struct {
+	config   string
+	backends string
+	targets  string
+	selector string
+}
+
+func (f *targetFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.config, "config", "config.yaml", "path to the config file")
+	fs.StringVar(&f.backends, "backend", "", "comma-separated backends to check, e.g. es,tidb (default all)")
+	fs.StringVar(&f.targets, "target", "", `comma-separated target names to check, e.g. "TiDB 2" (default all)`)
+	fs.StringVar(&f.selector, "selector", "", "check only targets with all these labels, e.g. env=prod,region=eu")
+}
+
+// load reads the config and returns the selected targets.
+func (f *targetFlags) load() (*Config, []service.Target, error) {
+	config, targets, err := loadConfig(f.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	labels, err := service.ParseSelector(f.selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	targets, err = service.Select(targets, service.Filter{
+		Backends: service.SplitList(f.backends),
+		Names:    service.SplitList(f.targets),
+		Labels:   labels,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, targets, nil
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
+
+// outputFlags select how the report of a run is written.
+type outputFlags struct {
+	format string
+	file   string
+}
+
+func (f *outputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.format, "output", "text", fmt.Sprintf("report format, one of %v", report.Formats))
+	fs.StringVar(&f.file, "output-file", "", "write the report to this file instead of stdout")
+}
+
+// progress is where step progress goes: stdout, unless stdout carries a
+// machine-readable report.
+func (f *outputFlags) progress() io.Writer {
+	if f.format == "text" || f.file != "" {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+func (f *outputFlags) write(r model.Report) error {
+	if f.file == "" {
+		return report.Write(os.Stdout, f.format, r)
+	}
+	out, err := os.Create(f.file)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(out, f.format, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// concurrency is the configured concurrency with the --parallel flag, if
+// set, in place of concurrency.workers.
+func concurrency(config *Config, parallel int) model.Concurrency {
+	c := config.Concurrency
+	if parallel > 0 {
+		c.Workers = parallel
+	}
+	return c
+}
+
+// effectiveConfig is the config as the selected targets were built from
+// it, after interpolation and with *_file keys read.
+type effectiveConfig struct {
+	Policy      model.Policy      `yaml:"policy"`
+	Schedule    model.Schedule    `yaml:"schedule"`
+	Concurrency model.Concurrency `yaml:"concurrency"`
+	Timeouts    model.Timeouts    `yaml:"timeouts"`
+	Retry       model.Retry       `yaml:"retry"`
+	Backends    map[string][]any  `yaml:",inline"`
+}
+
+// showConfig writes the effective config as YAML, with every secret masked.
+func showConfig(w io.Writer, config *Config, targets []service.Target) error {
+	eff := effectiveConfig{
+		Policy:      config.Policy,
+		Schedule:    config.Schedule,
+		Concurrency: config.Concurrency,
+		Timeouts:    model.Timeouts{}.Override(config.Timeouts),
+		Retry:       model.Retry{}.Override(config.Retry),
+		Backends:    make(map[string][]any),
+	}
+	for _, t := range targets {
+		eff.Backends[t.Backend] = append(eff.Backends[t.Backend], t.Config)
+	}
+
+	var node yaml.Node
+	if err := node.Encode(eff); err != nil {
+		return err
+	}
+	redact.Node(&node)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// parseExit is the exit code for a flag parse error; -h is not a failure.
+func parseExit(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitConfig
+}
+
+func runCommand(ctx context.Context, args []string) int {
+	var tf targetFlags
+	fs := newFlagSet("run")
+	tf.register(fs)
+	steps := fs.String("steps", "", "comma-separated steps to run, e.g. insert,read (setup steps and the steps they need always run)")
+	parallel := fs.Int("parallel", 0, "number of targets to check at once, overriding concurrency.workers")
+	show := fs.Bool("show-config", false, "print the effective config, with secrets masked, before running")
+	var of outputFlags
+	of.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+	if err := report.CheckFormat(of.format); err != nil {
+		return fail(exitConfig, err)
+	}
+
+	config, targets, err := tf.load()
+	if err != nil {
+		return fail(exitConfig, err)
+	}
+	opts := config.options()
+	opts.Concurrency = concurrency(config, *parallel)
+	opts.Steps = service.SplitList(*steps)
+	opts.Progress = of.progress()
+	if err := opts.Validate(targets); err != nil {
+		return fail(exitConfig, err)
+	}
+	if *show {
+		if err := showConfig(opts.Progress, config, targets); err != nil {
+			return fail(exitConfig, err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result := service.Run(ctx, targets, opts)
+	if err := of.write(result); err != nil {
+		return fail(exitFailed, err)
+	}
+	return exitCode(result)
+}
+
+func serveCommand(ctx context.Context, args []string) int {
+	var tf targetFlags
+	fs := newFlagSet("serve")
+	tf.register(fs)
+	listen := fs.String("listen", ":8000", "address to serve HTTP on")
+	keep := fs.Int("keep", 100, "number of finished runs to keep results for")
+	parallel := fs.Int("parallel", 0, "number of targets each run checks at once, overriding concurrency.workers")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	config, targets, err := tf.load()
+	if err != nil {
+		return fail(exitConfig, err)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := config.options()
+	opts.Concurrency = concurrency(config, *parallel)
+	srv := server.New(targets, opts, *keep)
+	if err := srv.ListenAndServe(ctx, *listen); err != nil {
+		return fail(exitFailed, err)
+	}
+	return exitOK
+}
+
+func daemonCommand(ctx context.Context, args []string) int {
+	var tf targetFlags
+	fs := newFlagSet("daemon")
+	tf.register(fs)
+	listen := fs.String("listen", ":8000", `address to serve results and metrics on ("" to disable)`)
+	keep := fs.Int("keep", 100, "number of finished runs to keep results for")
+	interval := fs.Duration("interval", 0, "time between runs of a target, overriding schedule.interval")
+	jitter := fs.Duration("jitter", 0, "random delay added to every interval, overriding schedule.jitter")
+	parallel := fs.Int("parallel", 0, "number of targets checked at once, overriding concurrency.workers")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	config, targets, err := tf.load()
+	if err != nil {
+		return fail(exitConfig, err)
+	}
+	sched := config.Schedule
+	if *interval > 0 {
+		sched.Interval = *interval
+	}
+	if *jitter > 0 {
+		sched.Jitter = *jitter
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := config.options()
+	opts.Concurrency = concurrency(config, *parallel)
+	srv := server.New(targets, opts, *keep)
+	if *listen == "" {
+		service.Schedule(ctx, targets, opts, sched, srv.Record)
+		return exitOK
+	}
+
+	// POST /run checks fresh copies of the targets, so it never shares a
+	// connection with the scheduled runs.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	scheduled := make(chan struct{})
+	go func() {
+		defer close(scheduled)
+		service.Schedule(ctx, targets, opts, sched, srv.Record)
+	}()
+	err = srv.ListenAndServe(ctx, *listen)
+	cancel()
+	<-scheduled
+	if err != nil {
+		return fail(exitFailed, err)
+	}
+	return exitOK
+}
+
+func validateCommand(args []string) int {
+	var tf targetFlags
+	fs := newFlagSet("validate")
+	tf.register(fs)
+	show := fs.Bool("show-config", false, "print the effective config, with secrets masked")
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	config, targets, err := tf.load()
+	if err != nil {
+		return fail(exitConfig, err)
+	}
+	if *show {
+		if err := showConfig(os.Stdout, config, targets); err != nil {
+			return fail(exitConfig, err)
+		}
+	}
+	fmt.Printf("✓ %s is valid (%d targets)\n", tf.config, len(targets))
+	return exitOK
+}
+
+func listCommand(args []string) int {
+	var tf targetFlags
+	fs := newFlagSet("list")
+	tf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+
+	_, targets, err := tf.load()
+	if err != nil {
+		return fail(exitConfig, err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tBACKEND\tADDRESS\tLABELS\tSTEPS")
+	for _, t := range targets {
+		var steps []string
+		for _, s := range t.Checker.Steps() {
+			steps = append(steps, s.Name)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t.Name, t.Backend, t.Checker.Addr(), cmp.Or(report.Labels(t.Options.Labels), "-"), strings.Join(steps, ","))
+	}
+	tw.Flush()
+	return exitOK
+}
+
+func cleanupCommand(ctx context.Context, args []string) int {
+	var tf targetFlags
+	fs := newFlagSet("cleanup")
+	tf.register(fs)
+	parallel := fs.Int("parallel", 0, "number of targets to clean up at once, overriding concurrency.workers")
+	var sweep service.Sweep
+	fs.DurationVar(&sweep.OlderThan, "older-than", 0, "only remove data of runs that started at least this long ago, e.g. 24h (default: the target timeout plus the step timeout)")
+	fs.BoolVar(&sweep.All, "all", false, "remove the data of every run, even runs in progress, and drop shared tables")
+	fs.BoolVar(&sweep.DryRun, "dry-run", false, "list the data that would be removed without removing it")
+	var of outputFlags
+	of.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return parseExit(err)
+	}
+	if err := report.CheckFormat(of.format); err != nil {
+		return fail(exitConfig, err)
+	}
+	if sweep.OlderThan < 0 {
+		return fail(exitConfig, errors.New("--older-than must not be negative"))
+	}
+	if sweep.All && sweep.OlderThan > 0 {
+		return fail(exitConfig, errors.New("--all and --older-than cannot be combined"))
+	}
+
+	config, targets, err := tf.load()
+	if err != nil {
+		return fail(exitConfig, err)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := config.options()
+	opts.Concurrency = concurrency(config, *parallel)
+	opts.Progress = of.progress()
+	result := service.Cleanup(ctx, targets, opts, sweep)
+	if err := of.write(result); err != nil {
+		return fail(exitFailed, err)
+	}
+	return exitCode(result)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // each error, as line:column: message
+	}{
+		{
+			name: "valid",
+			src:  "tidb:\n  - host: db.local\n    port: 4000\npolicy:\n  non_fatal_steps: [scan]",
+		},
+		{
+			name: "unknown top-level key",
+			src:  "tidb:\n  - host: db.local\n    port: 4000\npolcy:\n  on_failure: continue",
+			want: []string{`4:1: unknown key "polcy"`},
+		},
+		{
+			name: "unknown backend key",
+			src:  "tidb:\n  - host: db.local\n    port: 4000\n    passwrod: x",
+			want: []string{`4:5: unknown key "passwrod"`},
+		},
+		{
+			name: "unknown nested key",
+			src:  "es:\n  - host: es.local\n    port: 9200\n    health:\n      enabled: true\n      allow_yelow: true",
+			want: []string{`6:7: unknown key "allow_yelow"`},
+		},
+		{
+			name: "wrong scalar type",
+			src:  "tidb:\n  - host: db.local\n    port: high",
+			want: []string{`3:11: `},
+		},
+		{
+			name: "wrong scalar type in a section",
+			src:  "tidb:\n  - host: db.local\n    port: 4000\nretry:\n  attempts: many",
+			want: []string{`5:13: `},
+		},
+		{
+			name: "section error at the section",
+			src:  "tidb:\n  - host: db.local\n    port: 4000\ntimeouts:\n  step: -1s",
+			want: []string{`5:3: timeouts must not be negative`},
+		},
+		{
+			name: "misspelt non-fatal step",
+			src:  "tidb:\n  - host: db.local\n    port: 4000\npolicy:\n  non_fatal_steps: [scna]",
+			want: []string{`5:21: policy.non_fatal_steps: no target has a step "scna"`},
+		},
+		{
+			name: "misspelt non-fatal step along with other errors",
+			src:  "tidb:\n  - host: db.local\n    port: high\npolicy:\n  non_fatal_steps: [scna]\nretry:\n  attempts: many",
+			want: []string{
+				`3:11: `,
+				`5:21: policy.non_fatal_steps: no target has a step "scna"`,
+				`7:13: `,
+			},
+		},
+		{
+			name: "step of a backend with an invalid entry",
+			src:  "es:\n  - host: es.local\n    port: x\n    bulk:\n      docs: 10\npolicy:\n  non_fatal_steps: [bulk]",
+			want: []string{`3:11: `},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseConfig([]byte(tt.src))
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want %q", tt.want)
+			}
+			// Errors come grouped by kind, not in file order
+			got := strings.Split(err.Error(), "\n")
+			slices.Sort(got)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(got[i], want) {
+					t.Errorf("error %d is %q, want %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ go 1.25.4
 require (
 	github.com/ClickHouse/clickhouse-go/v2 v2.41.0
 	github.com/elastic/go-elasticsearch/v9 v9.2.0
+	github.com/go-sql-driver/mysql v1.9.3
+	github.com/prometheus/client_golang v1.14.0
 	github.com/tikv/client-go/v2 v2.0.7
 	go.yaml.in/yaml/v4 v4.0.0-rc.3
 )
@@ -25,7 +27,6 @@ require (
 	github.com/go-faster/errors v0.7.1 // indirect
 	github.com/go-logr/logr v1.4.3 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
-	github.com/go-sql-driver/mysql v1.9.3 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/google/btree v1.1.2 // indirect
@@ -41,7 +42,6 @@ require (
 	github.com/pingcap/kvproto v0.0.0-20230403051650-e166ae588106 // indirect
 	github.com/pingcap/log v1.1.1-0.20221110025148-ca232912c9f3 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/prometheus/client_golang v1.14.0 // indirect
 	github.com/prometheus/client_model v0.3.0 // indirect
 	github.com/prometheus/common v0.39.0 // indirect
 	github.com/prometheus/procfs v0.9.0 // indirect
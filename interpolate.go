@@ -0,0 +1,102 @@
+package main
+
+import (
+	"data-check-all/redact"
+	"data-check-all/service"
+	"errors"
+	"go.yaml.in/yaml/v4"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envRef matches ${VAR} and ${VAR:-default}; $${ escapes a literal ${.
+var envRef = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// interpolate rewrites the config in place before it is decoded:
+//
+//   - ${VAR} in a value is replaced by the environment variable VAR, and
+//     ${VAR:-default} by default when VAR is unset or empty.
+//   - a secret key with a _file suffix, e.g. password_file, is replaced by
+//     the key without the suffix, holding the contents of the named file.
+//     This lets mounted secrets such as Kubernetes ones be used directly.
+//     Other keys ending in _file, such as labels, are left alone.
+//
+// Every problem found is returned, joined.
+func interpolate(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return expandEnv(node)
+	case yaml.MappingNode:
+		var errs []error
+		for i := 0; i < len(node.Content); i += 2 {
+			errs = append(errs, interpolate(node.Content[i+1]))
+		}
+		return errors.Join(append(errs, readFileKeys(node))...)
+	}
+	var errs []error
+	for _, child := range node.Content {
+		errs = append(errs, interpolate(child))
+	}
+	return errors.Join(errs...)
+}
+
+func expandEnv(node *yaml.Node) error {
+	if !strings.Contains(node.Value, "${") {
+		return nil
+	}
+	var missing []string
+	node.Value = envRef.ReplaceAllStringFunc(node.Value, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		m := envRef.FindStringSubmatch(ref)
+		if v := os.Getenv(m[1]); v != "" {
+			return v
+		}
+		if m[2] != "" {
+			return strings.TrimPrefix(m[2], ":-")
+		}
+		if _, ok := os.LookupEnv(m[1]); !ok {
+			missing = append(missing, m[1])
+		}
+		return ""
+	})
+	if len(missing) > 0 {
+		return service.ErrorAt(node, "environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	// Let an unquoted value resolve again, so ${PORT} can still be an int
+	if node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+		node.Tag = ""
+	}
+	return nil
+}
+
+func readFileKeys(node *yaml.Node) error {
+	var errs []error
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		name, ok := strings.CutSuffix(key.Value, "_file")
+		if !ok || !redact.IsSecret(name) {
+			continue
+		}
+		both := false
+		for j := 0; j < len(node.Content); j += 2 {
+			both = both || node.Content[j].Value == name
+		}
+		if both {
+			errs = append(errs, service.ErrorAt(key, "%s and %s are both set", name, key.Value))
+			continue
+		}
+		data, err := os.ReadFile(value.Value)
+		if err != nil {
+			errs = append(errs, service.ErrorAt(value, "%s: %v", key.Value, err))
+			continue
+		}
+		key.Value = name
+		value.Value = strings.TrimRight(string(data), "\r\n")
+		value.Tag = "!!str"
+		value.Style = yaml.DoubleQuotedStyle
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"go.yaml.in/yaml/v4"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// interpolated parses src, interpolates it and decodes the result.
+func interpolated(t *testing.T, src string) (map[string]any, error) {
+	t.Helper()
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := interpolate(doc.Content[0]); err != nil {
+		return nil, err
+	}
+	var got map[string]any
+	if err := doc.Content[0].Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	return got, nil
+}
+
+func TestInterpolateEnv(t *testing.T) {
+	t.Setenv("DC_HOST", "es.local")
+	t.Setenv("DC_PORT", "9200")
+	t.Setenv("DC_EMPTY", "")
+
+	tests := []struct {
+		name string
+		src  string
+		want map[string]any
+	}{
+		{"variable", "host: ${DC_HOST}", map[string]any{"host": "es.local"}},
+		{"in text", "url: https://${DC_HOST}:${DC_PORT}", map[string]any{"url": "https://es.local:9200"}},
+		{"default unused", "host: ${DC_HOST:-other}", map[string]any{"host": "es.local"}},
+		{"default when unset", "host: ${DC_UNSET:-fallback}", map[string]any{"host": "fallback"}},
+		{"default when empty", "host: ${DC_EMPTY:-fallback}", map[string]any{"host": "fallback"}},
+		{"empty without default", "host: x${DC_EMPTY}", map[string]any{"host": "x"}},
+		{"escaped", "msg: $${DC_HOST}", map[string]any{"msg": "${DC_HOST}"}},
+		{"unquoted resolves as int", "port: ${DC_PORT}", map[string]any{"port": 9200}},
+		{"quoted stays a string", `port: "${DC_PORT}"`, map[string]any{"port": "9200"}},
+		{"nested", "es:\n  - host: ${DC_HOST}", map[string]any{"es": []any{map[string]any{"host": "es.local"}}}},
+		{"no reference", "host: $HOME", map[string]any{"host": "$HOME"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolated(t, tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateUnset(t *testing.T) {
+	_, err := interpolated(t, "host: ${DC_UNSET_HOST}\nport: ${DC_UNSET_PORT}\npassword_file: /nonexistent")
+	for _, want := range []string{
+		"1:7: environment variable DC_UNSET_HOST is not set",
+		"2:7: environment variable DC_UNSET_PORT is not set",
+		"3:16: password_file:",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got %v, want it to report %q", err, want)
+		}
+	}
+}
+
+func TestInterpolateFiles(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "password")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		src     string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "secret read from file",
+			src:  "password_file: " + secret,
+			want: map[string]any{"password": "s3cret"},
+		},
+		{
+			name: "token read from file",
+			src:  "api_key_file: " + secret,
+			want: map[string]any{"api_key": "s3cret"},
+		},
+		{
+			name: "path field left alone",
+			src:  "ssl_ca_crt_file: /etc/ca.crt",
+			want: map[string]any{"ssl_ca_crt_file": "/etc/ca.crt"},
+		},
+		{
+			name: "label left alone",
+			src:  "labels:\n  log_file: /var/log/x",
+			want: map[string]any{"labels": map[string]any{"log_file": "/var/log/x"}},
+		},
+		{
+			name:    "both set",
+			src:     "password: x\npassword_file: " + secret,
+			wantErr: "2:1: password and password_file are both set",
+		},
+		{
+			name:    "missing file",
+			src:     "password_file: " + filepath.Join(dir, "none"),
+			wantErr: "1:16: password_file:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolated(t, tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,41 +1,223 @@
 package main
 
 import (
+	"context"
 	"data-check-all/model"
 	"data-check-all/service"
+	"errors"
 	"fmt"
 	"go.yaml.in/yaml/v4"
 	"log"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Process exit codes, so CI and cron can tell a broken cluster from a
+// broken config.
+const (
+	exitOK          = 0
+	exitFailed      = 1 // at least one target failed
+	exitConfig      = 2 // config missing or invalid, or bad usage
+	exitInterrupted = 130
 )
 
 type Config struct {
-	Clickhouses []model.ClickHouseConfig `yaml:"clickhouse"` // Note: lowercase to match YAML key
-	Tidbs       []model.TiDBConfig       `yaml:"tidb"`
-	Tikvs       []model.TiKVConfig       `yaml:"tikv"`
-	Ess         []model.ESConfig         `yaml:"es"`
+	Policy      model.Policy      `yaml:"policy"`
+	Schedule    model.Schedule    `yaml:"schedule"`
+	Concurrency model.Concurrency `yaml:"concurrency"`
+	Timeouts    model.Timeouts    `yaml:"timeouts"`
+	Retry       model.Retry       `yaml:"retry"`
+	// Backends holds one section per registered backend, keyed by its
+	// YAML name (clickhouse, tidb, tikv, es).
+	Backends map[string]yaml.Node `yaml:",inline"`
 }
 
+const usage = `Usage: alldbtest <command> [flags]
+
+Commands:
+  run       run the checks against every selected target (default)
+  validate  report every problem in the config file, with its line and column
+  list      list the configured targets
+  cleanup   remove test data left behind by earlier runs
+  serve     serve checks over HTTP (POST /run, GET /results/{id}, /metrics)
+  daemon    check every target on a schedule, serving results and metrics
+
+Run "alldbtest <command> -h" for the flags of a command.
+`
+
 func main() {
-	data, err := os.ReadFile("config.yaml")
+	os.Exit(run(context.Background(), os.Args[1:]))
+}
+
+func run(ctx context.Context, args []string) int {
+	cmd := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "run":
+		return runCommand(ctx, args)
+	case "validate":
+		return validateCommand(args)
+	case "list":
+		return listCommand(args)
+	case "cleanup":
+		return cleanupCommand(ctx, args)
+	case "serve":
+		return serveCommand(ctx, args)
+	case "daemon":
+		return daemonCommand(ctx, args)
+	case "help":
+		fmt.Print(usage)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+	return exitConfig
+}
+
+// loadConfig reads the config file and builds its targets. Every problem
+// found is reported, each prefixed with the file and, when known, the line
+// and column.
+func loadConfig(path string) (*Config, []service.Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	config, targets, err := parseConfig(data)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, configError(path, err)
 	}
+	return config, targets, nil
+}
 
+func parseConfig(data []byte) (*Config, []service.Target, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, errors.New("config is empty")
+	}
+	root := doc.Content[0]
+	// Keep going after interpolation problems, to report the rest too
+	errs := []error{interpolate(root)}
+	errs = append(errs, service.CheckKeys(root, reflect.TypeFor[Config](), service.Backends()...)...)
+	errs = append(errs, checkNonFatalSteps(root)...)
+	// Values that fail to decode stay zero, and the rest is still checked
 	var config Config
-	err = yaml.Unmarshal(data, &config)
-	if err != nil {
-		log.Fatal(err)
+	if err := root.Decode(&config); err != nil {
+		errs = append(errs, service.DecodeErrors(err)...)
+	}
+	errs = append(errs,
+		sectionError(root, "policy", config.Policy.Validate()),
+		sectionError(root, "schedule", config.Schedule.Validate()),
+		sectionError(root, "concurrency", config.Concurrency.Validate()),
+		sectionError(root, "timeouts", config.Timeouts.Validate()),
+		sectionError(root, "retry", config.Retry.Validate()),
+	)
+	if perBackend := valueOf(valueOf(root, "concurrency"), "per_backend"); perBackend != nil {
+		for i := 0; i < len(perBackend.Content); i += 2 {
+			if key := perBackend.Content[i]; !slices.Contains(service.Backends(), key.Value) {
+				errs = append(errs, service.ErrorAt(key, "concurrency.per_backend: unknown backend %q", key.Value))
+			}
+		}
+	}
+
+	// Unknown sections were reported by CheckKeys, with their position
+	for name := range config.Backends {
+		if !slices.Contains(service.Backends(), name) {
+			delete(config.Backends, name)
+		}
 	}
+	targets, err := service.Load(config.Backends)
+	if err := errors.Join(append(errs, err)...); err != nil {
+		return nil, nil, err
+	}
+	return &config, targets, nil
+}
+
+// valueOf returns the value of key in the mapping node, or nil when node
+// is nil or has no such key.
+func valueOf(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
 
-	// Example: Print parsed config
-	fmt.Printf("ClickHouse: %+v\n", config.Clickhouses)
-	fmt.Printf("TiDB: %+v\n", config.Tidbs)
-	fmt.Printf("TiKV: %+v\n", config.Tikvs)
-	fmt.Printf("ES: %+v\n", config.Ess)
+// sectionError places err, the problem of a top-level section, at the
+// position of that section. A section left out of the file has its
+// defaults, which are valid, so err is then returned unchanged.
+func sectionError(root *yaml.Node, section string, err error) error {
+	node := valueOf(root, section)
+	if err == nil || node == nil {
+		return err
+	}
+	return service.ErrorAt(node, "%v", err)
+}
+
+// checkNonFatalSteps reports every step in policy.non_fatal_steps that no
+// target has, such as a misspelt one, which would otherwise do nothing.
+func checkNonFatalSteps(root *yaml.Node) []error {
+	steps := service.StepNames(root)
+	var errs []error
+	if names := valueOf(valueOf(root, "policy"), "non_fatal_steps"); names != nil {
+		for _, name := range names.Content {
+			if !slices.Contains(steps, name.Value) {
+				errs = append(errs, service.ErrorAt(name, "policy.non_fatal_steps: no target has a step %q", name.Value))
+			}
+		}
+	}
+	return errs
+}
+
+// configError prefixes every error joined in err with the config path, so
+// each reads as file:line:column: message.
+func configError(path string, err error) error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, configError(path, e))
+		}
+		return errors.Join(errs...)
+	}
+	var ce *service.ConfigError
+	if errors.As(err, &ce) {
+		return fmt.Errorf("%s:%w", path, err)
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+// options are the run options every command takes from the config.
+func (c *Config) options() service.Options {
+	return service.Options{
+		Policy:      c.Policy,
+		Concurrency: c.Concurrency,
+		Timeouts:    c.Timeouts,
+		Retry:       c.Retry,
+	}
+}
+
+// exitCode maps the outcome of a run to the process exit code.
+func exitCode(r model.Report) int {
+	switch {
+	case r.Interrupted:
+		return exitInterrupted
+	case r.Failed():
+		return exitFailed
+	}
+	return exitOK
+}
 
-	service.TestES(config.Ess)
-	service.TestTiKV(config.Tikvs)
-	service.TestClickHouse(config.Clickhouses)
-	service.TestTiDB(config.Tidbs)
+func fail(code int, err error) int {
+	log.Print(err)
+	return code
 }
@@ -0,0 +1,118 @@
+// Package metrics exports check results to Prometheus.
+package metrics
+
+import (
+	"data-check-all/model"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "datacheck"
+
+// Metrics holds the check result metrics of one process.
+type Metrics struct {
+	registry         *prometheus.Registry
+	stepSuccess      *prometheus.GaugeVec
+	stepDuration     *prometheus.HistogramVec
+	lastSuccess      *prometheus.GaugeVec
+	connectFailures  *prometheus.CounterVec
+	stepTimeouts     *prometheus.CounterVec
+	stepRetries      *prometheus.CounterVec
+	authFailures     *prometheus.CounterVec
+	teardownFailures *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		stepSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "step_success",
+			Help:      "Whether the last run of the step passed (1) or failed (0).",
+		}, []string{"backend", "target", "step"}),
+		stepDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "step_duration_seconds",
+			Help:      "Time taken by each step.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"backend", "target", "step"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "target_last_success_timestamp_seconds",
+			Help:      "Unix time of the last run in which every step of the target passed.",
+		}, []string{"backend", "target"}),
+		connectFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "connect_failures_total",
+			Help:      "Number of runs that could not connect to the target.",
+		}, []string{"backend", "target"}),
+		stepTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "step_timeouts_total",
+			Help:      "Number of times the step ran out of time.",
+		}, []string{"backend", "target", "step"}),
+		stepRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "step_retries_total",
+			Help:      "Number of times the step was tried again after a transient error.",
+		}, []string{"backend", "target", "step"}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_failures_total",
+			Help:      "Number of times the server rejected the credentials or their privileges.",
+		}, []string{"backend", "target", "step"}),
+		teardownFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "teardown_failures_total",
+			Help:      "Number of runs whose teardown action failed, leaving test data behind.",
+		}, []string{"backend", "target", "action"}),
+	}
+	m.registry.MustRegister(m.stepSuccess, m.stepDuration, m.lastSuccess, m.connectFailures, m.stepTimeouts, m.stepRetries, m.authFailures, m.teardownFailures)
+	return m
+}
+
+// Observe records the results of a finished run. Skipped steps leave their
+// metrics untouched.
+func (m *Metrics) Observe(r model.Report) {
+	finished := r.Started.Add(r.Duration)
+	for _, t := range r.Targets {
+		for _, s := range t.Steps {
+			if s.Status == model.StatusSkip {
+				continue
+			}
+			success := 0.0
+			if s.Status == model.StatusPass {
+				success = 1
+			}
+			m.stepSuccess.WithLabelValues(t.Backend, t.Target, s.Step).Set(success)
+			m.stepDuration.WithLabelValues(t.Backend, t.Target, s.Step).Observe(s.Duration.Seconds())
+			if s.Step == "connect" && s.Status.Failed() {
+				m.connectFailures.WithLabelValues(t.Backend, t.Target).Inc()
+			}
+			if s.Status == model.StatusTimeout {
+				m.stepTimeouts.WithLabelValues(t.Backend, t.Target, s.Step).Inc()
+			}
+			if s.Status == model.StatusAuth {
+				m.authFailures.WithLabelValues(t.Backend, t.Target, s.Step).Inc()
+			}
+			if s.Attempts > 1 {
+				m.stepRetries.WithLabelValues(t.Backend, t.Target, s.Step).Add(float64(s.Attempts - 1))
+			}
+		}
+		for _, s := range t.Teardown {
+			if s.Status.Failed() {
+				m.teardownFailures.WithLabelValues(t.Backend, t.Target, s.Step).Inc()
+			}
+		}
+		if !t.Failed() && len(t.Steps) > 0 && t.Steps[0].Status == model.StatusPass {
+			m.lastSuccess.WithLabelValues(t.Backend, t.Target).Set(float64(finished.Unix()))
+		}
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
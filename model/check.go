@@ -0,0 +1,57 @@
+package model
+
+import (
+	"fmt"
+	"os"
+)
+
+// FieldError is a problem with one field of a target config. Field is the
+// YAML key of the field.
+type FieldError struct {
+	Field string
+	Msg   string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Msg
+}
+
+func checkEndpoint(host string, port int) []FieldError {
+	var errs []FieldError
+	if host == "" {
+		errs = append(errs, FieldError{"host", "is required"})
+	}
+	switch {
+	case port == 0:
+		errs = append(errs, FieldError{"port", "is required"})
+	case port < 1 || port > 65535:
+		errs = append(errs, FieldError{"port", fmt.Sprintf("must be between 1 and 65535, got %d", port)})
+	}
+	return errs
+}
+
+// fileField is a config field holding a file path.
+type fileField struct {
+	name string
+	path string
+}
+
+// checkTLSFiles reports the files that are required but missing, and the
+// ones that are set but cannot be read.
+func checkTLSFiles(required []fileField, optional ...fileField) []FieldError {
+	var errs []FieldError
+	for _, f := range required {
+		if f.path == "" {
+			errs = append(errs, FieldError{f.name, "is required when TLS is enabled"})
+		}
+	}
+	for _, f := range append(required, optional...) {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.ReadFile(f.path); err != nil {
+			errs = append(errs, FieldError{f.name, fmt.Sprintf("cannot read certificate: %v", err)})
+		}
+	}
+	return errs
+}
@@ -1,6 +1,8 @@
 package model
 
 type ClickHouseConfig struct {
+	TargetOptions `yaml:",inline"`
+
 	Host           string `yaml:"host"`
 	Port           int    `yaml:"port"`
 	Username       string `yaml:"username"`
@@ -13,3 +15,16 @@ type ClickHouseConfig struct {
 	SSLClientKey   string `yaml:"ssl_client_key"`
 	SSLCACRT       string `yaml:"ssl_ca_crt"`
 }
+
+// Check reports the problems of the config that would make every run fail.
+func (c ClickHouseConfig) Check() []FieldError {
+	errs := append(c.TargetOptions.check(), checkEndpoint(c.Host, c.Port)...)
+	if c.TLS {
+		errs = append(errs, checkTLSFiles([]fileField{
+			{"ssl_client_crt", c.SSLClientCRT},
+			{"ssl_client_key", c.SSLClientKey},
+			{"ssl_ca_crt", c.SSLCACRT},
+		})...)
+	}
+	return errs
+}
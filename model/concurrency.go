@@ -0,0 +1,25 @@
+package model
+
+import "fmt"
+
+// Concurrency limits how many targets are checked at the same time.
+type Concurrency struct {
+	// Workers is the number of targets checked at once. 0 or 1 checks them
+	// one after another.
+	Workers int `yaml:"workers"`
+	// PerBackend caps the targets of one backend checked at once, e.g.
+	// {es: 2}, on top of Workers.
+	PerBackend map[string]int `yaml:"per_backend"`
+}
+
+func (c Concurrency) Validate() error {
+	if c.Workers < 0 {
+		return fmt.Errorf("concurrency.workers must not be negative, got %d", c.Workers)
+	}
+	for backend, n := range c.PerBackend {
+		if n < 1 {
+			return fmt.Errorf("concurrency.per_backend.%s must be at least 1, got %d", backend, n)
+		}
+	}
+	return nil
+}
@@ -1,5 +1,11 @@
 package model
-import("time")
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
 
 type TestDocument struct {
 	ID    string    `json:"id"`
@@ -7,9 +13,158 @@ type TestDocument struct {
 	Value int       `json:"value"`
 	Ts    time.Time `json:"timestamp"`
 }
+
+// DefaultSlowNode is the round trip time above which a node is slow.
+const DefaultSlowNode = 2 * time.Second
+
 type ESConfig struct {
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	TargetOptions `yaml:",inline"`
+
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// Addresses lists host:port of several nodes, in place of host and
+	// port.
+	Addresses []string `yaml:"addresses"`
+	// Discover adds every node the cluster lists in _nodes/http. When that
+	// fails, as without the monitor privilege, the configured nodes are
+	// used, with a warning.
+	Discover bool `yaml:"discover"`
+	// PerNode adds a step running the index and search round trip through
+	// each node on its own, failing on nodes that are unreachable or slower
+	// than SlowNode.
+	PerNode  bool          `yaml:"per_node"`
+	SlowNode time.Duration `yaml:"slow_node"` // DefaultSlowNode when zero
+	// Username and password are basic auth. The other credentials replace
+	// it, and only one kind may be set.
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	APIKey       string `yaml:"api_key"` // base64 id:key, as returned when creating the key
+	ServiceToken string `yaml:"service_token"`
+	BearerToken  string `yaml:"bearer_token"` // e.g. an OAuth2 or JWT access token
+	// Scheme is "https" (default) or "http". The ssl_ fields apply to
+	// https only.
+	Scheme        string `yaml:"scheme"`
+	SSLCACRT      string `yaml:"ssl_ca_crt"` // the system trust store when empty
+	SSLClientCRT  string `yaml:"ssl_client_crt"`
+	SSLClientKey  string `yaml:"ssl_client_key"`
+	SSLServerName string `yaml:"ssl_server_name"` // name to verify instead of host
+	SSLInsecure   bool   `yaml:"ssl_insecure"`    // skip verifying the server certificate
+	// Health enables and tunes the read-only cluster health steps.
+	Health ESHealth `yaml:"health"`
+	// Bulk adds a bulk indexing throughput step when Docs is set.
+	Bulk ESBulk `yaml:"bulk"`
+}
+
+// Defaults of ESHealth.
+const (
+	DefaultMaxTaskWait = 30 * time.Second
+	DefaultDiskMargin  = 5.0
+)
+
+// ESHealth sets what the cluster health steps tolerate.
+type ESHealth struct {
+	// Enabled adds the steps, which need the cluster monitor privilege.
+	Enabled bool `yaml:"enabled"`
+	// AllowYellow passes a yellow cluster, whose replicas are not all
+	// assigned. Red always fails.
+	AllowYellow         bool `yaml:"allow_yellow"`
+	MaxUnassignedShards int  `yaml:"max_unassigned_shards"`
+	// MaxTaskWait is the longest a pending cluster task may have waited.
+	// DefaultMaxTaskWait when zero.
+	MaxTaskWait time.Duration `yaml:"max_task_wait"`
+	// DiskMargin fails a node whose disk use is within this many percentage
+	// points of the high watermark. DefaultDiskMargin when zero.
+	DiskMargin float64 `yaml:"disk_margin"`
+}
+
+func (h ESHealth) check() []FieldError {
+	var errs []FieldError
+	if h.MaxUnassignedShards < 0 || h.MaxTaskWait < 0 || h.DiskMargin < 0 {
+		errs = append(errs, FieldError{"health", "limits must not be negative"})
+	}
+	return errs
+}
+
+// ESBulk sizes the bulk indexing step.
+type ESBulk struct {
+	Docs    int `yaml:"docs"`    // generated documents to index; no step when zero
+	Workers int `yaml:"workers"` // concurrent bulk requests, the CPU count when zero
+	// FlushBytes is the size of each bulk request, 5MB when zero.
+	FlushBytes int `yaml:"flush_bytes"`
+}
+
+func (b ESBulk) check() []FieldError {
+	var errs []FieldError
+	if b.Docs < 0 || b.Workers < 0 || b.FlushBytes < 0 {
+		errs = append(errs, FieldError{"bulk", "sizes must not be negative"})
+	}
+	return errs
+}
+
+// Check reports the problems of the config that would make every run fail.
+// At most one kind of credentials is set, the CA is optional, and the
+// client certificate and key go together.
+func (c ESConfig) Check() []FieldError {
+	errs := c.TargetOptions.check()
+	switch {
+	case len(c.Addresses) == 0:
+		errs = append(errs, checkEndpoint(c.Host, c.Port)...)
+	case c.Host != "" || c.Port != 0:
+		errs = append(errs, FieldError{"addresses", "cannot be combined with host and port"})
+	}
+	for _, addr := range c.Addresses {
+		host, port, err := net.SplitHostPort(addr)
+		p, _ := strconv.Atoi(port)
+		if err != nil || host == "" || p < 1 || p > 65535 {
+			errs = append(errs, FieldError{"addresses", fmt.Sprintf("%q is not a host:port address", addr)})
+		}
+	}
+	if c.SlowNode < 0 {
+		errs = append(errs, FieldError{"slow_node", "must not be negative"})
+	}
+	errs = append(errs, c.Health.check()...)
+	errs = append(errs, c.Bulk.check()...)
+	var auth []string
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"username", c.Username != "" || c.Password != ""},
+		{"api_key", c.APIKey != ""},
+		{"service_token", c.ServiceToken != ""},
+		{"bearer_token", c.BearerToken != ""},
+	} {
+		if f.set && len(auth) > 0 {
+			errs = append(errs, FieldError{f.name, "cannot be combined with " + auth[0]})
+		}
+		if f.set {
+			auth = append(auth, f.name)
+		}
+	}
+	switch c.Scheme {
+	case "", "https":
+	case "http":
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"ssl_ca_crt", c.SSLCACRT != ""},
+			{"ssl_client_crt", c.SSLClientCRT != ""},
+			{"ssl_client_key", c.SSLClientKey != ""},
+			{"ssl_server_name", c.SSLServerName != ""},
+			{"ssl_insecure", c.SSLInsecure},
+		} {
+			if f.set {
+				errs = append(errs, FieldError{f.name, "is only used with scheme https"})
+			}
+		}
+		return errs
+	default:
+		return append(errs, FieldError{"scheme", fmt.Sprintf(`must be "http" or "https", got %q`, c.Scheme)})
+	}
+	var client []fileField
+	if c.SSLClientCRT != "" || c.SSLClientKey != "" {
+		client = []fileField{{"ssl_client_crt", c.SSLClientCRT}, {"ssl_client_key", c.SSLClientKey}}
+	}
+	return append(errs, checkTLSFiles(client, fileField{"ssl_ca_crt", c.SSLCACRT})...)
 }
@@ -0,0 +1,40 @@
+package model
+
+import "fmt"
+
+const (
+	OnFailureContinue = "continue"
+	OnFailureFailFast = "fail-fast"
+)
+
+// Policy decides what a failure means for the rest of the run.
+type Policy struct {
+	// OnFailure is "continue" (default) to check every target, or
+	// "fail-fast" to stop after the first target that fails.
+	OnFailure string `yaml:"on_failure"`
+	// NonFatalSteps are reported as warnings instead of failing the target,
+	// e.g. "scan".
+	NonFatalSteps []string `yaml:"non_fatal_steps"`
+}
+
+func (p Policy) Validate() error {
+	switch p.OnFailure {
+	case "", OnFailureContinue, OnFailureFailFast:
+		return nil
+	}
+	return fmt.Errorf("policy.on_failure must be %q or %q, got %q", OnFailureContinue, OnFailureFailFast, p.OnFailure)
+}
+
+func (p Policy) FailFast() bool {
+	return p.OnFailure == OnFailureFailFast
+}
+
+// NonFatal reports whether a failure of step should only be a warning.
+func (p Policy) NonFatal(step string) bool {
+	for _, s := range p.NonFatalSteps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package model
+
+import "time"
+
+type StepStatus string
+
+const (
+	StatusPass StepStatus = "pass"
+	StatusFail StepStatus = "fail"
+	StatusWarn StepStatus = "warn" // failed, but the policy marks the step non-fatal
+	StatusSkip StepStatus = "skip"
+	// StatusTimeout is a failure because the step, or the whole target,
+	// ran out of time.
+	StatusTimeout StepStatus = "timeout"
+	// StatusAuth is a failure because the server rejected the credentials
+	// or their privileges.
+	StatusAuth StepStatus = "auth"
+)
+
+// Failed reports whether the status is a failure of any kind.
+func (s StepStatus) Failed() bool {
+	return s == StatusFail || s == StatusTimeout || s == StatusAuth
+}
+
+// StepResult is the outcome of one step against one target.
+type StepResult struct {
+	Target        string
+	Backend       string
+	Step          string
+	Status        StepStatus
+	Duration      time.Duration // of all attempts, with the waits between them
+	Attempts      int           // 0 when skipped
+	Error         string        // of the last attempt
+	ServerVersion string
+}
+
+// TargetResult groups the steps run against one configured target.
+type TargetResult struct {
+	Target        string
+	Backend       string
+	Labels        map[string]string
+	Addr          string
+	ServerVersion string
+	Duration      time.Duration
+	Steps         []StepResult
+	// Teardown holds the actions that undid what the steps created, in the
+	// order they ran. A failed one leaves test data behind but does not
+	// fail the target.
+	Teardown []StepResult
+}
+
+// Failed reports whether any step of the target failed.
+func (t TargetResult) Failed() bool {
+	return failed(t.Steps)
+}
+
+// TeardownFailed reports whether any teardown action failed.
+func (t TargetResult) TeardownFailed() bool {
+	return failed(t.Teardown)
+}
+
+func failed(steps []StepResult) bool {
+	for _, s := range steps {
+		if s.Status.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// Report is everything a single run produced.
+type Report struct {
+	RunID    string
+	Started  time.Time
+	Duration time.Duration
+	Targets  []TargetResult
+	// Interrupted is set when the run was cancelled before every target
+	// finished.
+	Interrupted bool
+}
+
+// Failed reports whether any target failed.
+func (r Report) Failed() bool {
+	for _, t := range r.Targets {
+		if t.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// TeardownFailed returns the targets that left test data behind because a
+// teardown action failed.
+func (r Report) TeardownFailed() []string {
+	var targets []string
+	for _, t := range r.Targets {
+		if t.TeardownFailed() {
+			targets = append(targets, t.Target)
+		}
+	}
+	return targets
+}
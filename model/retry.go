@@ -0,0 +1,54 @@
+package model
+
+import (
+	"cmp"
+	"fmt"
+	"time"
+)
+
+// Defaults for the retry policy. A step is tried once unless attempts is
+// set.
+const (
+	DefaultBackoff    = 500 * time.Millisecond
+	DefaultMaxBackoff = 10 * time.Second
+)
+
+// Retry decides how often a step that failed with a transient error, such
+// as a dropped connection, is tried again.
+type Retry struct {
+	// Attempts is the number of tries in total, the first included.
+	Attempts int `yaml:"attempts,omitempty"`
+	// Backoff is the wait before the second try, doubled before each
+	// following one up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff,omitempty"`
+	MaxBackoff time.Duration `yaml:"max_backoff,omitempty"`
+	// Jitter is the largest random delay added to each wait.
+	Jitter time.Duration `yaml:"jitter,omitempty"`
+}
+
+func (r Retry) Validate() error {
+	if r.Attempts < 0 || r.Backoff < 0 || r.MaxBackoff < 0 || r.Jitter < 0 {
+		return fmt.Errorf("retry settings must not be negative")
+	}
+	return nil
+}
+
+// Override returns r with every setting made in o replacing its own, and
+// the defaults for those set in neither.
+func (r Retry) Override(o Retry) Retry {
+	return Retry{
+		Attempts:   cmp.Or(o.Attempts, r.Attempts, 1),
+		Backoff:    cmp.Or(o.Backoff, r.Backoff, DefaultBackoff),
+		MaxBackoff: cmp.Or(o.MaxBackoff, r.MaxBackoff, DefaultMaxBackoff),
+		Jitter:     cmp.Or(o.Jitter, r.Jitter),
+	}
+}
+
+// Wait is the backoff before try number attempt+1, without jitter.
+func (r Retry) Wait(attempt int) time.Duration {
+	wait := r.Backoff
+	for i := 1; i < attempt && wait < r.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, r.MaxBackoff)
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryWait(t *testing.T) {
+	r := Retry{Backoff: 500 * time.Millisecond, MaxBackoff: 3 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 500 * time.Millisecond},
+		{2, time.Second},
+		{3, 2 * time.Second},
+		{4, 3 * time.Second},
+		{10, 3 * time.Second},
+		{100, 3 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := r.Wait(tt.attempt); got != tt.want {
+			t.Errorf("Wait(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+
+	capped := Retry{Backoff: 20 * time.Second, MaxBackoff: 10 * time.Second}
+	if got := capped.Wait(1); got != 10*time.Second {
+		t.Errorf("Wait(1) with a backoff above the maximum = %s, want 10s", got)
+	}
+}
+
+func TestRetryOverride(t *testing.T) {
+	got := Retry{Attempts: 3, Backoff: time.Second}.Override(Retry{Backoff: 2 * time.Second, Jitter: time.Millisecond})
+	want := Retry{Attempts: 3, Backoff: 2 * time.Second, MaxBackoff: DefaultMaxBackoff, Jitter: time.Millisecond}
+	if got != want {
+		t.Errorf("Override = %+v, want %+v", got, want)
+	}
+	if got, want := (Retry{}).Override(Retry{}), (Retry{Attempts: 1, Backoff: DefaultBackoff, MaxBackoff: DefaultMaxBackoff}); got != want {
+		t.Errorf("Override of nothing = %+v, want the defaults %+v", got, want)
+	}
+}
+
+func TestTimeoutsOverride(t *testing.T) {
+	got := Timeouts{Step: time.Second, Target: time.Hour}.Override(Timeouts{Target: time.Minute})
+	want := Timeouts{Connect: DefaultConnectTimeout, Step: time.Second, Target: time.Minute}
+	if got != want {
+		t.Errorf("Override = %+v, want %+v", got, want)
+	}
+}
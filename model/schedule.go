@@ -0,0 +1,32 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+const DefaultInterval = time.Minute
+
+// Schedule controls how often the daemon checks each target.
+type Schedule struct {
+	Interval time.Duration `yaml:"interval"` // default 1m
+	Jitter   time.Duration `yaml:"jitter"`   // random delay added to every interval
+}
+
+func (s Schedule) Validate() error {
+	if s.Interval < 0 || s.Jitter < 0 {
+		return fmt.Errorf("schedule.interval and schedule.jitter must not be negative")
+	}
+	return nil
+}
+
+// IntervalFor is the interval of a target, falling back to the global one.
+func (s Schedule) IntervalFor(o TargetOptions) time.Duration {
+	switch {
+	case o.Interval > 0:
+		return o.Interval
+	case s.Interval > 0:
+		return s.Interval
+	}
+	return DefaultInterval
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// TargetOptions are the settings every target accepts on top of its
+// connection details. Backend configs embed it inline.
+type TargetOptions struct {
+	// Name identifies the target in all output and in --target. Defaults
+	// to the backend title and position, e.g. "TiDB 2".
+	Name string `yaml:"name,omitempty"`
+	// Labels are free-form tags, e.g. env: prod, matched by --selector.
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Timeouts override the global timeouts for this target.
+	Timeouts Timeouts `yaml:"timeouts,omitempty"`
+	// Retry overrides the global retry policy for this target.
+	Retry Retry `yaml:"retry,omitempty"`
+	// Interval overrides schedule.interval for this target in daemon mode.
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+func (o TargetOptions) Options() TargetOptions {
+	return o
+}
+
+func (o TargetOptions) check() []FieldError {
+	var errs []FieldError
+	if o.Timeouts.Validate() != nil {
+		errs = append(errs, FieldError{"timeouts", "must not be negative"})
+	}
+	if o.Retry.Validate() != nil {
+		errs = append(errs, FieldError{"retry", "must not be negative"})
+	}
+	if o.Interval < 0 {
+		errs = append(errs, FieldError{"interval", "must not be negative"})
+	}
+	return errs
+}
@@ -1,6 +1,8 @@
 package model
 
 type TiDBConfig struct {
+	TargetOptions `yaml:",inline"`
+
 	Host         string `yaml:"host"`
 	Port         int    `yaml:"port"`
 	Username     string `yaml:"username"`
@@ -12,3 +14,17 @@ type TiDBConfig struct {
 	SSLCACRT     string `yaml:"ssl_ca_crt"`
 	TLS          bool   `yaml:"tls"`
 }
+
+// Check reports the problems of the config that would make every run fail.
+// The CA is optional, and the client certificate and key go together.
+func (c TiDBConfig) Check() []FieldError {
+	errs := append(c.TargetOptions.check(), checkEndpoint(c.Host, c.Port)...)
+	if !c.TLS {
+		return errs
+	}
+	var client []fileField
+	if c.SSLClientCRT != "" || c.SSLClientKey != "" {
+		client = []fileField{{"ssl_client_crt", c.SSLClientCRT}, {"ssl_client_key", c.SSLClientKey}}
+	}
+	return append(errs, checkTLSFiles(client, fileField{"ssl_ca_crt", c.SSLCACRT})...)
+}
@@ -1,6 +1,8 @@
 package model
 
-import ("time")
+import (
+	"time"
+)
 
 type TestKeyValue struct {
 	Key   string    `json:"key"`
@@ -9,6 +11,8 @@ type TestKeyValue struct {
 }
 
 type TiKVConfig struct {
+	TargetOptions `yaml:",inline"`
+
 	Host         string `yaml:"host"`
 	Port         int    `yaml:"port"`
 	SSLClientCRT string `yaml:"ssl_client_crt"`
@@ -16,3 +20,17 @@ type TiKVConfig struct {
 	SSLCACRT     string `yaml:"ssl_ca_crt"`
 	Prefix       string `yaml:"prefix"`
 }
+
+// Check reports the problems of the config that would make every run fail.
+// TLS is used when any certificate is set, and then needs all three.
+func (c TiKVConfig) Check() []FieldError {
+	errs := append(c.TargetOptions.check(), checkEndpoint(c.Host, c.Port)...)
+	if c.SSLClientCRT != "" || c.SSLClientKey != "" || c.SSLCACRT != "" {
+		errs = append(errs, checkTLSFiles([]fileField{
+			{"ssl_client_crt", c.SSLClientCRT},
+			{"ssl_client_key", c.SSLClientKey},
+			{"ssl_ca_crt", c.SSLCACRT},
+		})...)
+	}
+	return errs
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"cmp"
+	"fmt"
+	"time"
+)
+
+// Default timeouts, used when neither the target nor the config sets one.
+const (
+	DefaultConnectTimeout = 10 * time.Second
+	DefaultStepTimeout    = time.Minute
+	DefaultTargetTimeout  = 5 * time.Minute
+)
+
+// Timeouts bound how long a target may take. Each applies through the
+// context passed to the driver calls.
+type Timeouts struct {
+	Connect time.Duration `yaml:"connect,omitempty"`
+	Step    time.Duration `yaml:"step,omitempty"`   // each step, cleanup included
+	Target  time.Duration `yaml:"target,omitempty"` // the whole target, connect included
+}
+
+func (t Timeouts) Validate() error {
+	if t.Connect < 0 || t.Step < 0 || t.Target < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	return nil
+}
+
+// Override returns t with every timeout set in o replacing its own, and the
+// defaults for those set in neither.
+func (t Timeouts) Override(o Timeouts) Timeouts {
+	return Timeouts{
+		Connect: cmp.Or(o.Connect, t.Connect, DefaultConnectTimeout),
+		Step:    cmp.Or(o.Step, t.Step, DefaultStepTimeout),
+		Target:  cmp.Or(o.Target, t.Target, DefaultTargetTimeout),
+	}
+}
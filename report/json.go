@@ -0,0 +1,93 @@
+package report
+
+import (
+	"data-check-all/model"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// JSONReport is the machine-readable form of a run.
+type JSONReport struct {
+	RunID       string    `json:"run_id"`
+	Started     time.Time `json:"started"`
+	Duration    float64   `json:"duration_seconds"`
+	Passed      bool      `json:"passed"`
+	Interrupted bool      `json:"interrupted"`
+	// TeardownFailed is set when a target left test data behind, which
+	// does not fail the run.
+	TeardownFailed bool         `json:"teardown_failed"`
+	Targets        []JSONTarget `json:"targets"`
+}
+
+type JSONTarget struct {
+	Target         string            `json:"target"`
+	Backend        string            `json:"backend"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Addr           string            `json:"address"`
+	ServerVersion  string            `json:"server_version,omitempty"`
+	Passed         bool              `json:"passed"`
+	TeardownFailed bool              `json:"teardown_failed"`
+	Duration       float64           `json:"duration_seconds"`
+	Steps          []JSONStep        `json:"steps"`
+	Teardown       []JSONStep        `json:"teardown,omitempty"`
+}
+
+type JSONStep struct {
+	Step     string           `json:"step"`
+	Status   model.StepStatus `json:"status"`
+	Duration float64          `json:"duration_seconds"`
+	Attempts int              `json:"attempts,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// ToJSON converts r to its JSON document.
+func ToJSON(r model.Report) JSONReport {
+	doc := JSONReport{
+		RunID:          r.RunID,
+		Started:        r.Started,
+		Duration:       r.Duration.Seconds(),
+		Passed:         !r.Failed() && !r.Interrupted,
+		Interrupted:    r.Interrupted,
+		TeardownFailed: len(r.TeardownFailed()) > 0,
+		Targets:        make([]JSONTarget, 0, len(r.Targets)),
+	}
+	for _, t := range r.Targets {
+		jt := JSONTarget{
+			Target:         t.Target,
+			Backend:        t.Backend,
+			Labels:         t.Labels,
+			Addr:           t.Addr,
+			ServerVersion:  t.ServerVersion,
+			Passed:         !t.Failed(),
+			TeardownFailed: t.TeardownFailed(),
+			Duration:       t.Duration.Seconds(),
+			Steps:          make([]JSONStep, 0, len(t.Steps)),
+		}
+		for _, s := range t.Steps {
+			jt.Steps = append(jt.Steps, toJSONStep(s))
+		}
+		for _, s := range t.Teardown {
+			jt.Teardown = append(jt.Teardown, toJSONStep(s))
+		}
+		doc.Targets = append(doc.Targets, jt)
+	}
+	return doc
+}
+
+func toJSONStep(s model.StepResult) JSONStep {
+	return JSONStep{
+		Step:     s.Step,
+		Status:   s.Status,
+		Duration: s.Duration.Seconds(),
+		Attempts: s.Attempts,
+		Error:    s.Error,
+	}
+}
+
+// WriteJSON writes r as a single indented JSON document.
+func WriteJSON(w io.Writer, r model.Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ToJSON(r))
+}
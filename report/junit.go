@@ -0,0 +1,130 @@
+package report
+
+import (
+	"data-check-all/model"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Name     string       `xml:"name,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnit writes r as a JUnit XML document. Every target becomes a
+// testsuite and every step a testcase, so datastore failures show up in CI
+// test views.
+func WriteJUnit(w io.Writer, r model.Report) error {
+	doc := junitSuites{Name: "run " + r.RunID, Time: seconds(r.Duration)}
+	for _, t := range r.Targets {
+		suite := junitSuite{
+			Name:      t.Target,
+			Time:      seconds(t.Duration),
+			Timestamp: r.Started.Format("2006-01-02T15:04:05"),
+			Properties: []junitProperty{
+				{Name: "backend", Value: t.Backend},
+				{Name: "address", Value: t.Addr},
+				{Name: "server_version", Value: t.ServerVersion},
+			},
+		}
+		for _, k := range slices.Sorted(maps.Keys(t.Labels)) {
+			suite.Properties = append(suite.Properties, junitProperty{Name: "label." + k, Value: t.Labels[k]})
+		}
+		for _, s := range t.Steps {
+			tc := junitCase{
+				Name:      s.Step,
+				Classname: t.Backend + "." + t.Target,
+				Time:      seconds(s.Duration),
+			}
+			switch s.Status {
+			case model.StatusFail, model.StatusTimeout, model.StatusAuth:
+				tc.Failure = &junitFailure{Message: s.Error, Type: string(s.Status), Text: s.Error}
+				suite.Failures++
+			case model.StatusSkip:
+				tc.Skipped = &struct{}{}
+				suite.Skipped++
+			case model.StatusWarn:
+				tc.SystemOut = "warning: " + s.Error
+			}
+			if s.Attempts > 1 {
+				tc.SystemOut = strings.TrimSpace(fmt.Sprintf("attempts: %d\n%s", s.Attempts, tc.SystemOut))
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		// A failed teardown leaves data behind without failing the target,
+		// so it is reported like a warning.
+		for _, s := range t.Teardown {
+			tc := junitCase{
+				Name:      "teardown " + s.Step,
+				Classname: t.Backend + "." + t.Target,
+				Time:      seconds(s.Duration),
+			}
+			if s.Error != "" {
+				tc.SystemOut = fmt.Sprintf("teardown %s: %s", s.Status, s.Error)
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suite.Tests = len(suite.Cases)
+
+		doc.Tests += suite.Tests
+		doc.Failures += suite.Failures
+		doc.Skipped += suite.Skipped
+		doc.Suites = append(doc.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,34 @@
+// Package report renders the result of a run for people and machines.
+package report
+
+import (
+	"data-check-all/model"
+	"fmt"
+	"io"
+)
+
+// Formats are the output formats accepted by Write.
+var Formats = []string{"text", "json", "junit"}
+
+// CheckFormat returns an error if format is not one of Formats.
+func CheckFormat(format string) error {
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q (want one of %v)", format, Formats)
+}
+
+// Write renders r in the given format.
+func Write(w io.Writer, format string, r model.Report) error {
+	switch format {
+	case "json":
+		return WriteJSON(w, r)
+	case "junit":
+		return WriteJUnit(w, r)
+	case "text":
+		return WriteText(w, r)
+	}
+	return CheckFormat(format)
+}
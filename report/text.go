@@ -0,0 +1,73 @@
+package report
+
+import (
+	"data-check-all/model"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var statusMark = map[model.StepStatus]string{
+	model.StatusPass:    "✓",
+	model.StatusFail:    "✗",
+	model.StatusWarn:    "⚠",
+	model.StatusSkip:    "-",
+	model.StatusTimeout: "⧗",
+	model.StatusAuth:    "⊘",
+}
+
+// WriteText prints a per-target summary table of the run.
+func WriteText(w io.Writer, r model.Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "\n=== Summary of run %s (%s) ===\n", r.RunID, r.Duration.Round(time.Millisecond))
+	if r.Interrupted {
+		fmt.Fprintln(tw, "Run interrupted; targets not started are reported as skipped")
+	}
+	for _, t := range r.Targets {
+		version := t.ServerVersion
+		if version == "" {
+			version = "unknown version"
+		}
+		fmt.Fprintf(tw, "\n%s [%s] %s (%s)", t.Target, t.Backend, t.Addr, version)
+		if len(t.Labels) > 0 {
+			fmt.Fprintf(tw, " {%s}", Labels(t.Labels))
+		}
+		fmt.Fprintln(tw)
+		writeSteps(tw, "  ", t.Steps)
+		if len(t.Teardown) > 0 {
+			fmt.Fprintln(tw, "  teardown:")
+			writeSteps(tw, "    ", t.Teardown)
+		}
+	}
+	if failed := r.TeardownFailed(); len(failed) > 0 {
+		fmt.Fprintf(tw, "\n⚠ Teardown failed for %s; its test data was left behind until the cleanup command removes it\n", strings.Join(failed, ", "))
+	}
+	return tw.Flush()
+}
+
+func writeSteps(w io.Writer, indent string, steps []model.StepResult) {
+	for _, s := range steps {
+		took := "-"
+		if s.Status != model.StatusSkip {
+			took = s.Duration.Round(time.Millisecond).String()
+		}
+		if s.Attempts > 1 {
+			took += fmt.Sprintf(" (%d attempts)", s.Attempts)
+		}
+		fmt.Fprintf(w, "%s%s %s\t%s\t%s\n", indent, statusMark[s.Status], s.Step, took, s.Error)
+	}
+}
+
+// Labels formats labels as a selector would match them, sorted by key,
+// e.g. "env=prod,region=eu".
+func Labels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
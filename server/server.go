@@ -0,0 +1,255 @@
+// Package server exposes the checks over HTTP so the binary can run as a
+// long-lived service.
+package server
+
+import (
+	"context"
+	"data-check-all/metrics"
+	"data-check-all/model"
+	"data-check-all/report"
+	"data-check-all/service"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Server runs checks on request and keeps the most recent results.
+type Server struct {
+	targets []service.Target
+	opts    service.Options
+	keep    int
+	metrics *metrics.Metrics
+
+	ctx    context.Context // parent of every run; cancelled on shutdown
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	ready  bool
+	runs   map[string]*run
+	order  []string // run IDs, oldest first
+	latest string   // most recently finished run
+}
+
+type run struct {
+	done   chan struct{}
+	report model.Report
+}
+
+// New returns a server for targets. keep is the number of finished runs
+// whose results are retained.
+func New(targets []service.Target, opts service.Options, keep int) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		targets: targets,
+		opts:    opts,
+		keep:    max(keep, 1),
+		metrics: metrics.New(),
+		ctx:     ctx,
+		cancel:  cancel,
+		ready:   true,
+		runs:    make(map[string]*run),
+	}
+}
+
+// Handler returns the HTTP routes of the server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.HandleFunc("GET /readyz", s.readyz)
+	mux.HandleFunc("POST /run", s.startRun)
+	mux.HandleFunc("GET /results/latest", s.latestResult)
+	mux.HandleFunc("GET /results/{runID}", s.result)
+	mux.Handle("GET /metrics", s.metrics.Handler())
+	return mux
+}
+
+// ListenAndServe serves on addr until ctx is cancelled, then stops taking
+// requests, cancels runs in progress and waits for them to finish.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: s.Handler()}
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	log.Printf("Listening on %s", addr)
+
+	select {
+	case err := <-errc:
+		s.cancel()
+		return err
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	s.ready = false
+	s.mu.Unlock()
+
+	s.cancel()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	s.wg.Wait()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ready := s.ready
+	s.mu.Unlock()
+	if !ready {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+type runStatus struct {
+	RunID  string `json:"run_id"`
+	Status string `json:"status"`
+}
+
+// startRun starts a run of the targets selected by the backend, target,
+// selector and steps query parameters. It answers 202 with the run ID right away, or
+// with the full report when wait=true.
+func (s *Server) startRun(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	labels, err := service.ParseSelector(q.Get("selector"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	targets, err := service.Select(s.targets, service.Filter{
+		Backends: service.SplitList(q.Get("backend")),
+		Names:    service.SplitList(q.Get("target")),
+		Labels:   labels,
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts := s.opts
+	opts.Steps = service.SplitList(q.Get("steps"))
+	if err := opts.Validate(targets); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	for i := range targets {
+		targets[i] = targets[i].Fresh()
+	}
+
+	opts.RunID = service.NewRunID()
+	rn := &run{done: make(chan struct{})}
+	s.mu.Lock()
+	s.runs[opts.RunID] = rn
+	s.order = append(s.order, opts.RunID)
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		result := service.Run(s.ctx, targets, opts)
+		s.finish(opts.RunID, rn, result)
+	}()
+
+	if q.Get("wait") != "true" {
+		writeJSON(w, http.StatusAccepted, runStatus{RunID: opts.RunID, Status: "running"})
+		return
+	}
+	select {
+	case <-rn.done:
+		writeJSON(w, http.StatusOK, report.ToJSON(rn.report))
+	case <-r.Context().Done():
+	}
+}
+
+// Record stores the report of a run made outside the server, such as a
+// scheduled one, as if it had been started through POST /run.
+func (s *Server) Record(result model.Report) {
+	rn := &run{done: make(chan struct{})}
+	s.mu.Lock()
+	s.runs[result.RunID] = rn
+	s.order = append(s.order, result.RunID)
+	s.mu.Unlock()
+	s.finish(result.RunID, rn, result)
+}
+
+func (s *Server) finish(id string, rn *run, result model.Report) {
+	s.metrics.Observe(result)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rn.report = result
+	close(rn.done)
+	s.latest = id
+
+	// Forget finished runs beyond the newest keep
+	finished := 0
+	for i := len(s.order) - 1; i >= 0; i-- {
+		old := s.order[i]
+		if !s.runs[old].finished() {
+			continue
+		}
+		if finished++; finished > s.keep {
+			delete(s.runs, old)
+			s.order = slices.Delete(s.order, i, i+1)
+		}
+	}
+}
+
+func (rn *run) finished() bool {
+	select {
+	case <-rn.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) latestResult(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	rn := s.runs[s.latest]
+	s.mu.Unlock()
+	if rn == nil {
+		writeError(w, http.StatusNotFound, errors.New("no finished run yet"))
+		return
+	}
+	writeJSON(w, http.StatusOK, report.ToJSON(rn.report))
+}
+
+func (s *Server) result(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("runID")
+	s.mu.Lock()
+	rn := s.runs[id]
+	s.mu.Unlock()
+	switch {
+	case rn == nil:
+		writeError(w, http.StatusNotFound, errors.New("unknown run "+id))
+	case !rn.finished():
+		writeJSON(w, http.StatusAccepted, runStatus{RunID: id, Status: "running"})
+	default:
+		writeJSON(w, http.StatusOK, report.ToJSON(rn.report))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Checker is implemented by every backend. The engine connects, runs the
+// steps in order, tears down what they created and closes, so a backend
+// only has to describe what each step does. A step that creates something
+// registers how to undo it with onTeardown.
+type Checker interface {
+	// Addr is the address shown in the target header.
+	Addr() string
+	// Connect creates the client and verifies the server answers.
+	Connect(ctx context.Context) error
+	// Version is the server version seen by Connect, if the backend
+	// exposes one.
+	Version() string
+	// Steps returns the CRUD steps in the order they must run.
+	Steps() []Step
+	// SetRunID namespaces the test data of the steps that follow by run,
+	// so runs against the same cluster never collide.
+	SetRunID(id string)
+	// Artifacts lists the test data left behind by runs that started
+	// before the given time, or by every run when it is zero.
+	Artifacts(ctx context.Context, before time.Time) ([]Artifact, error)
+	// Remove deletes an artifact returned by Artifacts.
+	Remove(ctx context.Context, a Artifact) error
+	// Close releases the client created by Connect.
+	Close() error
+}
+
+// Step is a single check run against a connected backend.
+type Step struct {
+	Name  string // machine name, e.g. "insert"
+	Title string // printed before the step runs, e.g. "Inserting test documents"
+	// Run is called again after a timeout or a transient error, when the
+	// server may have acted on the failed attempt, so it must accept the
+	// outcome of that attempt.
+	Run func(ctx context.Context) error
+	// Required steps abort the target when they fail, since everything
+	// after them depends on the resource they create.
+	Required bool
+	// Needs names the steps whose results this one checks, which run with
+	// it even when --steps leaves them out.
+	Needs []string
+}
+
+// Artifact is test data found on a backend, such as an index, a table or
+// the keys written by one run.
+type Artifact struct {
+	Kind  string // "index", "table", "keys" or "rows"
+	Name  string
+	RunID string   // run that created it; empty when unknown
+	Keys  []string // for keys and rows, each one as stored
+}
+
+func (a Artifact) String() string {
+	if a.Keys != nil {
+		return fmt.Sprintf("%s %s (%d)", a.Kind, a.Name, len(a.Keys))
+	}
+	return a.Kind + " " + a.Name
+}
+
+// ErrAuth is matched by the errors of a checker whose server rejected the
+// credentials or their privileges. They are reported as auth failures and
+// never retried.
+var ErrAuth = errors.New("not authorized")
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	oldRun    = "20261017t100000-aaaa0001"
+	recentRun = "20261017t115500-aaaa0002"
+)
+
+// sweepStart is when the sweeps of the tests start: oldRun started two
+// hours before, recentRun five minutes before.
+var sweepStart = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+func TestKeyRunID(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"test_key_" + oldRun + "_1", oldRun},
+		{"test_key_" + oldRun + "_12", oldRun},
+		{"test_key_1", ""},
+		{"test_key_", ""},
+		{"test_key_nounderscore", ""},
+		{"test_key_not-a-run_3", "not-a-run"},
+	}
+	for _, tt := range tests {
+		if got := keyRunID(tt.key); got != tt.want {
+			t.Errorf("keyRunID(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestRunTime(t *testing.T) {
+	tests := []struct {
+		id   string
+		want time.Time
+		ok   bool
+	}{
+		{oldRun, time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC), true},
+		{NewRunID(), time.Time{}, true},
+		{"", time.Time{}, false},
+		{"20261017t100000", time.Time{}, false},
+		{"2026-10-17-aaaa", time.Time{}, false},
+		{"not-a-run", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := RunTime(tt.id)
+		if ok != tt.ok || ok && !tt.want.IsZero() && !got.Equal(tt.want) {
+			t.Errorf("RunTime(%q) = %v, %v, want %v, %v", tt.id, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSweepable(t *testing.T) {
+	longest := 10 * time.Minute // the timeouts of a run
+	inProgress := NewRunID()
+	tests := []struct {
+		name  string
+		runID string
+		sweep Sweep
+		want  bool
+	}{
+		{"old run", oldRun, Sweep{}, true},
+		{"recent run within the longest run", recentRun, Sweep{}, false},
+		{"run in progress", inProgress, Sweep{}, false},
+		{"unknown run", "", Sweep{}, true},
+		{"older than covers the old run", oldRun, Sweep{OlderThan: time.Hour}, true},
+		{"older than leaves the recent run", recentRun, Sweep{OlderThan: time.Hour}, false},
+		{"short older than takes the recent run", recentRun, Sweep{OlderThan: time.Minute}, true},
+		{"all takes the recent run", recentRun, Sweep{All: true}, true},
+		{"all takes the run in progress", inProgress, Sweep{All: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := sweepStart
+			if tt.runID == inProgress {
+				start = time.Now()
+			}
+			before := tt.sweep.before(start, longest)
+			if got := sweepable(tt.runID, before); got != tt.want {
+				t.Errorf("sweepable(%q, %v) = %v, want %v", tt.runID, before, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSweepBefore(t *testing.T) {
+	if got := (Sweep{All: true, OlderThan: time.Hour}).before(sweepStart, time.Minute); !got.IsZero() {
+		t.Errorf("all sweeps before %v, want zero", got)
+	}
+	if got, want := (Sweep{}).before(sweepStart, time.Minute), sweepStart.Add(-time.Minute); !got.Equal(want) {
+		t.Errorf("default sweeps before %v, want %v", got, want)
+	}
+	if got, want := (Sweep{OlderThan: time.Hour}).before(sweepStart, time.Minute), sweepStart.Add(-time.Hour); !got.Equal(want) {
+		t.Errorf("older than sweeps before %v, want %v", got, want)
+	}
+}
+
+func TestArtifacts(t *testing.T) {
+	p := keyspace("app/")
+	keys := []string{
+		"app/test_key_1",
+		"app/test_key_2",
+		"app/test_key_" + oldRun + "_1",
+		"app/test_key_" + oldRun + "_2",
+		"app/test_key_" + recentRun + "_1",
+	}
+	before := sweepStart.Add(-10 * time.Minute)
+
+	got := p.artifacts("keys", keys, before)
+	want := []Artifact{
+		{Kind: "keys", Name: "app/test_key_N", Keys: []string{"app/test_key_1", "app/test_key_2"}},
+		{Kind: "keys", Name: "app/test_key_" + oldRun + "_*", RunID: oldRun, Keys: []string{
+			"app/test_key_" + oldRun + "_1", "app/test_key_" + oldRun + "_2",
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("artifacts = %v, want %v", got, want)
+	}
+
+	if got := p.artifacts("keys", keys, time.Time{}); len(got) != 3 || got[2].RunID != recentRun {
+		t.Errorf("artifacts of every run = %v, want the recent run too", got)
+	}
+	if got := p.artifacts("keys", nil, before); got != nil {
+		t.Errorf("artifacts of no keys = %v, want none", got)
+	}
+}
+
+func TestTestRange(t *testing.T) {
+	p := keyspace("app/")
+	start, end := p.testRange(oldRun)
+	for _, key := range []string{p.add(testKey(oldRun, 1)), p.add(testKey(oldRun, 999))} {
+		if key < start || key >= end {
+			t.Errorf("%q is outside [%q, %q)", key, start, end)
+		}
+	}
+	for _, key := range []string{p.add(testKey(recentRun, 1)), p.add(testKey("", 1)), "app/other", testKey(oldRun, 1)} {
+		if key >= start && key < end {
+			t.Errorf("%q is inside [%q, %q), which holds only the keys of %s", key, start, end, oldRun)
+		}
+	}
+
+	start, end = p.testRange("")
+	for _, key := range []string{p.add(testKey(oldRun, 1)), p.add(testKey("", 1))} {
+		if key < start || key >= end {
+			t.Errorf("%q is outside [%q, %q)", key, start, end)
+		}
+	}
+	if key := "app/test_keyring"; key >= start && key < end {
+		t.Errorf("%q is inside [%q, %q)", key, start, end)
+	}
+}
+
+func TestIndexRunID(t *testing.T) {
+	tests := []struct {
+		index string
+		want  string
+	}{
+		{indexPrefix + oldRun, oldRun},
+		{indexPrefix + oldRun + bulkSuffix, oldRun},
+		{legacyIndex, ""},
+	}
+	for _, tt := range tests {
+		if got := indexRunID(tt.index); got != tt.want {
+			t.Errorf("indexRunID(%q) = %q, want %q", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestSweepTables(t *testing.T) {
+	rows := []Artifact{
+		{Kind: "rows", Keys: []string{"a", "b"}},
+		{Kind: "rows", Keys: []string{"c"}},
+	}
+	tests := []struct {
+		name     string
+		before   time.Time
+		found    []Artifact
+		testRows int
+		others   uint64
+		want     bool
+	}{
+		{"all runs, nothing else left", time.Time{}, rows, 3, 0, true},
+		{"empty tables", time.Time{}, nil, 0, 0, true},
+		{"only old runs", sweepStart, rows, 3, 0, false},
+		{"rows of recent runs left", time.Time{}, rows, 4, 0, false},
+		{"other rows left", time.Time{}, rows, 3, 1, false},
+	}
+	for _, tt := range tests {
+		if got := sweepTables(tt.before, tt.found, tt.testRows, tt.others); got != tt.want {
+			t.Errorf("%s: sweepTables = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
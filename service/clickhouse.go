@@ -3,333 +3,436 @@ package service
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"data-check-all/model"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/ClickHouse/clickhouse-go/v2"
-	"log"
-	"crypto/x509"
 	"os"
-	"strings"
+	"slices"
 	"time"
 )
 
-func TestClickHouse(chs []model.ClickHouseConfig) {
-	ctx := context.Background()
-	prefix := "devops" + ":"
+func init() {
+	Register("clickhouse", "ClickHouse", newClickHouseChecker)
+}
 
-	addPrefix := func(key string) string {
-		return prefix + key
-	}
+type clickHouseChecker struct {
+	cfg       model.ClickHouseConfig
+	keys      keyspace
+	runID     string
+	tableName string
+	table     string // database-qualified local table
+	db        *sql.DB
+	version   string
+	items     []model.TestKeyValue // keys inserted successfully
+	// deleteSent is the run whose delete step last sent its mutation, so
+	// a retry after a timeout accepts the key already gone.
+	deleteSent string
+}
 
-	removePrefix := func(key string) string {
-		return strings.TrimPrefix(key, prefix)
-	}
-	loadCertFromFile := func(filePath string) ([]byte, error) {
-		if filePath == "" {
-			return nil, errors.New("empty file path")
-		}
-		data, err := os.ReadFile(filePath) // Use os.ReadFile instead of ioutil
-		if err != nil {
-			return nil, fmt.Errorf("failed to read cert file %s: %w", filePath, err)
+func newClickHouseChecker(cfg model.ClickHouseConfig) Checker {
+	tableName := cfg.DBTableName
+	if tableName == "" {
+		tableName = cfg.LocalTableName
+		if tableName == "" {
+			tableName = "main_dist"
 		}
-		return data, nil
 	}
+	return &clickHouseChecker{
+		cfg:       cfg,
+		keys:      keyspace(cfg.Database + ":"),
+		tableName: tableName,
+		table:     cfg.Database + "." + tableName,
+	}
+}
 
-	getTLSConfig := func(ch model.ClickHouseConfig) *tls.Config {
-		if !ch.TLS {
-			return nil
-		}
-		certPEM, err := loadCertFromFile(ch.SSLClientCRT)
-		if err != nil {
-			log.Fatalf("Failed to load client cert: %v", err)
-		}
-		keyPEM, err := loadCertFromFile(ch.SSLClientKey)
-		if err != nil {
-			log.Fatalf("Failed to load client key: %v", err)
-		}
-		caPEM, err := loadCertFromFile(ch.SSLCACRT)
-		if err != nil {
-			log.Fatalf("Failed to load CA: %v", err)
-		}
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caPEM)
+func (c *clickHouseChecker) Addr() string {
+	return fmt.Sprintf("%s:%d", c.cfg.Host, c.cfg.Port)
+}
 
-		cert, err := tls.X509KeyPair(certPEM, keyPEM)
-		if err != nil {
-			log.Fatalf("Failed to parse client cert/key: %v", err)
-		}
+func loadCertFromFile(filePath string) ([]byte, error) {
+	if filePath == "" {
+		return nil, errors.New("empty file path")
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cert file %s: %w", filePath, err)
+	}
+	return data, nil
+}
 
-		tlsConfig := &tls.Config{
-			Certificates:       []tls.Certificate{cert},
-			RootCAs:            caCertPool,
-			ServerName:         ch.Host,     // Use host for SNI
-			InsecureSkipVerify: true, // Set true for self-signed/internal certs
-		}
-		return tlsConfig
+func (c *clickHouseChecker) tlsConfig() (*tls.Config, error) {
+	certPEM, err := loadCertFromFile(c.cfg.SSLClientCRT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client cert: %w", err)
+	}
+	keyPEM, err := loadCertFromFile(c.cfg.SSLClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client key: %w", err)
+	}
+	caPEM, err := loadCertFromFile(c.cfg.SSLCACRT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA: %w", err)
 	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(caPEM)
 
-	getClient := func(config model.ClickHouseConfig) (*sql.DB, error) {
-		log.Printf("Connecting to ClickHouse at %s:%d (TLS: %v)", config.Host, config.Port, config.TLS)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client cert/key: %w", err)
+	}
 
-		opts := &clickhouse.Options{
-			Addr: []string{fmt.Sprintf("%s:%d", config.Host, config.Port)},
-			Auth: clickhouse.Auth{
-				Database: config.Database,
-				Username: config.Username,
-				Password: config.Password,
-			},
-			ClientInfo: clickhouse.ClientInfo{
-				Products: []struct {
-					Name, Version string
-				}{
-					{Name: "clickhouse-test", Version: "1.0"},
-				},
-			},
-			DialTimeout:      time.Second * 10,
-			ConnOpenStrategy: clickhouse.ConnOpenInOrder,
-			Settings: clickhouse.Settings{
-				"max_execution_time": 60,
-			},
-			Compression: &clickhouse.Compression{
-				Method: clickhouse.CompressionLZ4,
+	return &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		RootCAs:            caCertPool,
+		ServerName:         c.cfg.Host, // Use host for SNI
+		InsecureSkipVerify: true,       // Set true for self-signed/internal certs
+	}, nil
+}
+
+func (c *clickHouseChecker) Connect(ctx context.Context) error {
+	logf(ctx, "Connecting to ClickHouse at %s (TLS: %v)", c.Addr(), c.cfg.TLS)
+
+	opts := &clickhouse.Options{
+		Addr: []string{c.Addr()},
+		Auth: clickhouse.Auth{
+			Database: c.cfg.Database,
+			Username: c.cfg.Username,
+			Password: c.cfg.Password,
+		},
+		ClientInfo: clickhouse.ClientInfo{
+			Products: []struct {
+				Name, Version string
+			}{
+				{Name: "clickhouse-test", Version: "1.0"},
 			},
-			ReadTimeout: time.Second * 300,
+		},
+		DialTimeout:      time.Second * 10,
+		ConnOpenStrategy: clickhouse.ConnOpenInOrder,
+		Settings: clickhouse.Settings{
+			"max_execution_time": 60,
+		},
+		Compression: &clickhouse.Compression{
+			Method: clickhouse.CompressionLZ4,
+		},
+		ReadTimeout: time.Second * 300,
+	}
+
+	if c.cfg.TLS {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return err
 		}
+		opts.TLS = tlsConfig
+	}
 
-		if config.TLS {
-			// Simple TLS config - in production use proper certificates
-			opts.TLS = getTLSConfig(config)
+	db := clickhouse.OpenDB(opts)
 
-			// If certificates provided, use them (simplified)
-			if config.SSLCACRT != "" {
-				// Add certificate parsing here if needed
-				log.Println("TLS with certificates enabled")
-			}
-		}
+	// Configure connection pool
+	db.SetMaxIdleConns(5)
+	db.SetMaxOpenConns(10)
+	db.SetConnMaxLifetime(time.Hour)
+
+	// Test connection
+	var version string
+	if err := db.QueryRowContext(ctx, "SELECT version()").Scan(&version); err != nil {
+		db.Close()
+		return fmt.Errorf("connection test failed: %w", err)
+	}
 
-		db := clickhouse.OpenDB(opts)
+	logf(ctx, "✓ Connected to ClickHouse %s", version)
+	c.db = db
+	c.version = version
+	return nil
+}
 
-		// Configure connection pool
-		db.SetMaxIdleConns(5)
-		db.SetMaxOpenConns(10)
-		db.SetConnMaxLifetime(time.Hour)
+func (c *clickHouseChecker) Version() string {
+	return c.version
+}
 
-		// Test connection
-		var version string
-		err := db.QueryRowContext(ctx, "SELECT version()").Scan(&version)
-		if err != nil {
-			db.Close()
-			return nil, fmt.Errorf("connection test failed: %w", err)
-		}
+func (c *clickHouseChecker) SetRunID(id string) {
+	c.runID = id
+}
 
-		log.Printf("✓ Connected to ClickHouse %s", version)
-		return db, nil
+func (c *clickHouseChecker) Steps() []Step {
+	return []Step{
+		{Name: "create_table", Title: "Creating table if not exists on cluster", Run: c.createTable, Required: true},
+		{Name: "create_dist_table", Title: "Creating distributed table", Run: c.createDistTable, Required: true},
+		{Name: "insert", Title: "Creating test keys", Run: c.insert},
+		{Name: "read", Title: "Reading test keys", Run: c.read, Needs: []string{"insert"}},
+		{Name: "update", Title: "Updating test key", Run: c.update, Needs: []string{"insert"}},
+		{Name: "scan", Title: "Scanning test keys", Run: c.scan, Needs: []string{"insert"}},
+		{Name: "delete", Title: "Deleting test key", Run: c.delete, Needs: []string{"insert"}},
 	}
+}
 
-	for i, chConfig := range chs {
-		fmt.Printf("\n=== Testing ClickHouse %d: %s:%d ===\n", i+1, chConfig.Host, chConfig.Port)
+func (c *clickHouseChecker) createTable(ctx context.Context) error {
+	createLocalTableSQL := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s ON CLUSTER '%s' (
+			key String,
+			value String
+		) ENGINE = ReplicatedMergeTree
+		ORDER BY key
+	`, c.table, "{cluster}")
+	if _, err := c.db.ExecContext(ctx, createLocalTableSQL); err != nil {
+		return fmt.Errorf("create local table: %w", err)
+	}
+	printf(ctx, "✓ Local table %s ready\n", c.table)
+	return nil
+}
 
-		// Set configuration for testing
-		prefix = chConfig.Database + ":"
-		tableName := chConfig.DBTableName
-		if tableName == "" {
-			tableName = chConfig.LocalTableName
-			if tableName == "" {
-				tableName = "main_dist"
-			}
-		}
+func (c *clickHouseChecker) createDistTable(ctx context.Context) error {
+	distTable := c.table + "_dist"
+	createDistTableSQL := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s ON CLUSTER '%s' AS %s
+		ENGINE = Distributed('%s', '%s', '%s', rand())
+	`, distTable, "{cluster}", c.table, "{cluster}", c.cfg.Database, c.tableName)
+	if _, err := c.db.ExecContext(ctx, createDistTableSQL); err != nil {
+		return fmt.Errorf("create distributed table: %w", err)
+	}
+	printf(ctx, "✓ Distributed table %s ready\n", distTable)
+	return nil
+}
 
-		db, err := getClient(chConfig)
+func (c *clickHouseChecker) insert(ctx context.Context) error {
+	c.items = nil // the checker may be reused across runs
+	onTeardown(ctx, "delete_keys", c.deleteKeys(c.runID))
+	var errs []error
+	for _, item := range newTestItems(c.runID) {
+		fullKey := c.keys.add(item.Key)
+		// The table does not deduplicate, so a key an attempt that timed
+		// out has inserted already is kept rather than inserted twice
+		n, err := c.count(ctx, item.Key)
 		if err != nil {
-			log.Printf("❌ Failed to create ClickHouse client: %v", err)
+			errs = append(errs, fmt.Errorf("look up key %s: %w", fullKey, err))
 			continue
 		}
-		defer db.Close()
-
-		// Test keys with prefix
-		baseKey := "test_key"
-		testKeys := []string{"1", "2", "3"}
-		testValues := []string{
-			"Initial value for test key 1",
-			"Initial value for test key 2",
-			"Initial value for test key 3",
+		if n > 0 {
+			c.items = append(c.items, item)
+			printf(ctx, "✓ Key %s already inserted by an earlier attempt\n", item.Key)
+			continue
 		}
-		// 0. CREATE TABLE IF NOT EXISTS ON CLUSTER
-		fmt.Println("0. Creating table if not exists on cluster...")
-		createLocalTableSQL := fmt.Sprintf(`
-			CREATE TABLE IF NOT EXISTS %s.%s ON CLUSTER '%s' (
-				key String,
-				value String
-			) ENGINE = ReplicatedMergeTree
-			ORDER BY key
-		`, chConfig.Database, tableName, "{cluster}")
-		_, err = db.ExecContext(ctx, createLocalTableSQL)
-		if err != nil {
-			log.Printf("❌ Create local table error: %v", err)
+		if _, err := c.db.ExecContext(ctx, "INSERT INTO "+c.table+" (key, value) VALUES (?, ?)", fullKey, item.Value); err != nil {
+			errs = append(errs, fmt.Errorf("insert key %s: %w", fullKey, err))
 			continue
-		} else {
-			fmt.Printf("✓ Local table %s.%s ready\n", chConfig.Database, tableName)
 		}
+		c.items = append(c.items, item)
+		printf(ctx, "✓ Key %s inserted with value: %s\n", item.Key, item.Value)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *clickHouseChecker) get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := c.db.QueryRowContext(ctx, "SELECT value FROM "+c.table+" WHERE key = ?", c.keys.add(key)).Scan(&value)
+	return value, err
+}
+
+func (c *clickHouseChecker) count(ctx context.Context, key string) (int, error) {
+	var n int
+	err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+c.table+" WHERE key = ?", c.keys.add(key)).Scan(&n)
+	return n, err
+}
 
-		// Create Distributed table
-		fmt.Println("0. Creating distributed table...")
-		distTableName := tableName + "_dist"
-		createDistTableSQL := fmt.Sprintf(`
-			CREATE TABLE IF NOT EXISTS %s.%s ON CLUSTER '%s' AS %s.%s
-			ENGINE = Distributed('%s', '%s', '%s', rand())
-		`, chConfig.Database, distTableName, "{cluster}", chConfig.Database, tableName, "{cluster}", chConfig.Database, tableName)
-		print(createDistTableSQL)
-		_, err = db.ExecContext(ctx, createDistTableSQL)
+func (c *clickHouseChecker) read(ctx context.Context) error {
+	if len(c.items) == 0 {
+		return errNoItems
+	}
+	var errs []error
+	for _, item := range c.items {
+		value, err := c.get(ctx, item.Key)
 		if err != nil {
-			log.Printf("❌ Create distributed table error: %v", err)
+			errs = append(errs, fmt.Errorf("get key %s: %w", item.Key, err))
+			continue
+		}
+		if value == "" {
+			errs = append(errs, fmt.Errorf("key %s not found", item.Key))
 			continue
-		} else {
-			fmt.Printf("✓ Distributed table %s.%s ready\n", chConfig.Database, distTableName)
 		}
+		printf(ctx, "✓ Key %s retrieved: %s\n", item.Key, value)
+	}
+	return errors.Join(errs...)
+}
 
-		// 1. CREATE (Insert) Keys
-		fmt.Println("1. Creating test keys...")
-		testItems := make([]struct{ Key, Value string }, len(testKeys))
+func (c *clickHouseChecker) update(ctx context.Context) error {
+	updateKey := testKey(c.runID, 1)
+	updatedValue := "Updated value for test key 1 - modified at " + time.Now().Format(time.RFC3339)
 
-		for j, key := range testKeys {
-			fullKey := addPrefix(baseKey + "_" + key)
-			value := testValues[j]
+	updateSQL := fmt.Sprintf("ALTER TABLE %s UPDATE value = ? WHERE key = ?", c.table)
+	if _, err := c.db.ExecContext(ctx, updateSQL, updatedValue, c.keys.add(updateKey)); err != nil {
+		return fmt.Errorf("update key %s: %w", updateKey, err)
+	}
 
-			_, err = db.ExecContext(ctx, "INSERT INTO "+chConfig.Database+"."+tableName+" (key, value) VALUES (?, ?)", fullKey, value)
-			if err != nil {
-				log.Printf("❌ Insert key %s error: %v", fullKey, err)
-				continue
-			}
+	// Wait briefly for mutation, then verify
+	if err := sleep(ctx, time.Second); err != nil {
+		return err
+	}
+	value, err := c.get(ctx, updateKey)
+	if err != nil || value == "" {
+		return fmt.Errorf("verification failed for updated key %s", updateKey)
+	}
+	printf(ctx, "✓ Key %s updated to: %s\n", updateKey, value)
+	return nil
+}
 
-			testItems[j] = struct{ Key, Value string }{baseKey + "_" + key, value}
-			fmt.Printf("✓ Key %s inserted with value: %s\n", baseKey+"_"+key, value)
-		}
+func (c *clickHouseChecker) scan(ctx context.Context) error {
+	if len(c.items) == 0 {
+		return errNoItems
+	}
+	startKey, endKey := c.keys.testRange(c.runID)
 
-		// 2. READ (Get) Keys
-		fmt.Println("2. Reading test keys...")
-		for _, item := range testItems {
-			if item.Key == "" {
-				continue // Skip if insert failed
-			}
-
-			fullKey := addPrefix(item.Key)
-			var retrievedValue string
-			err = db.QueryRowContext(ctx, "SELECT value FROM "+chConfig.Database+"."+tableName+" WHERE key = ?", fullKey).Scan(&retrievedValue)
-			if err != nil {
-				log.Printf("❌ Get key %s error: %v", item.Key, err)
-				continue
-			}
-
-			if retrievedValue == "" {
-				log.Printf("❌ Key %s not found", item.Key)
-				continue
-			}
-
-			fmt.Printf("✓ Key %s retrieved: %s\n", item.Key, retrievedValue)
+	rows, err := c.db.QueryContext(ctx, "SELECT key, value FROM "+c.table+" WHERE key >= ? AND key < ? LIMIT 100", startKey, endKey)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var fullKey, value string
+		if err := rows.Scan(&fullKey, &value); err != nil {
+			return err
 		}
+		printf(ctx, "  - %s: %s\n", c.keys.trim(fullKey), value)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	printf(ctx, "✓ Scan found %d keys in range\n", count)
+	return checkScanned(count, c.items)
+}
 
-		// 3. UPDATE Key
-		fmt.Println("3. Updating test key...")
-		updateKey := baseKey + "_1"
-		updatedValue := "Updated value for test key 1 - modified at " + time.Now().Format(time.RFC3339)
+func (c *clickHouseChecker) delete(ctx context.Context) error {
+	deleteKey := testKey(c.runID, 2)
+	retry := c.deleteSent == c.runID
+	c.deleteSent = c.runID
 
-		fullUpdateKey := addPrefix(updateKey)
-		updateSQL := fmt.Sprintf("ALTER TABLE %s.%s UPDATE value = ? WHERE key = ?", chConfig.Database, tableName)
-		_, err = db.ExecContext(ctx, updateSQL, updatedValue, fullUpdateKey)
-		if err != nil {
-			log.Printf("❌ Update key %s error: %v", updateKey, err)
-		} else {
-			// Wait briefly for mutation, then verify
-			time.Sleep(1 * time.Second)
-			var updatedBytes string
-			err = db.QueryRowContext(ctx, "SELECT value FROM "+chConfig.Database+"."+tableName+" WHERE key = ?", fullUpdateKey).Scan(&updatedBytes)
-			if err == nil && updatedBytes != "" {
-				fmt.Printf("✓ Key %s updated to: %s\n", updateKey, updatedBytes)
-			} else {
-				log.Printf("❌ Verification failed for updated key %s", updateKey)
-			}
-		}
+	// Verify exists before delete, unless an attempt that timed out may
+	// have deleted it already
+	if n, err := c.count(ctx, deleteKey); err != nil || n == 0 && !retry {
+		return fmt.Errorf("key %s not found for deletion", deleteKey)
+	}
+	deleteSQL := fmt.Sprintf("ALTER TABLE %s DELETE WHERE key = ?", c.table)
+	if _, err := c.db.ExecContext(ctx, deleteSQL, c.keys.add(deleteKey)); err != nil {
+		return fmt.Errorf("delete key %s: %w", deleteKey, err)
+	}
 
-		// 4. SCAN (Range Query) Test Keys
-		fmt.Println("4. Scanning test keys...")
-		startKey := addPrefix(baseKey + "_")
-		endKey := addPrefix(baseKey + "_z")
+	// Wait briefly for mutation, then verify
+	if err := sleep(ctx, time.Second); err != nil {
+		return err
+	}
+	if n, err := c.count(ctx, deleteKey); err != nil || n != 0 {
+		return fmt.Errorf("key %s still exists after deletion", deleteKey)
+	}
+	printf(ctx, "✓ Key %s deleted successfully\n", deleteKey)
+	return nil
+}
 
-		rows, err := db.QueryContext(ctx, "SELECT key, value FROM "+chConfig.Database+"."+tableName+" WHERE key >= ? AND key < ? LIMIT 100", startKey, endKey)
-		if err != nil {
-			log.Printf("❌ Scan error: %v", err)
-		} else {
-			count := 0
-			for rows.Next() {
-				var fullKey, value string
-				if err := rows.Scan(&fullKey, &value); err != nil {
-					break
-				}
-				cleanKey := removePrefix(fullKey)
-				fmt.Printf("  - %s: %s\n", cleanKey, value)
-				count++
-			}
-			fmt.Printf("✓ Scan found %d keys in range\n", count)
-			rows.Close()
-		}
+// deleteKeys returns the teardown deleting the test keys of the run. The
+// tables are shared by every run and stay; cleanup --all drops them
+// once empty.
+func (c *clickHouseChecker) deleteKeys(runID string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		startKey, endKey := c.keys.testRange(runID)
+		cleanupSQL := fmt.Sprintf("ALTER TABLE %s DELETE WHERE key >= ? AND key < ?", c.table)
+		_, err := c.db.ExecContext(ctx, cleanupSQL, startKey, endKey)
+		return err
+	}
+}
 
-		// 5. DELETE Key
-		fmt.Println("5. Deleting test key...")
-		deleteKey := baseKey + "_2"
-		fullDeleteKey := addPrefix(deleteKey)
-
-		// Verify exists before delete
-		var exists int
-		err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+chConfig.Database+"."+tableName+" WHERE key = ?", fullDeleteKey).Scan(&exists)
-		if err != nil || exists == 0 {
-			log.Printf("❌ Key %s not found for deletion", deleteKey)
-		} else {
-			deleteSQL := fmt.Sprintf("ALTER TABLE %s.%s DELETE WHERE key = ?", chConfig.Database, tableName)
-			_, err = db.ExecContext(ctx, deleteSQL, fullDeleteKey)
-			if err != nil {
-				log.Printf("❌ Delete key %s error: %v", deleteKey, err)
-			} else {
-				// Wait briefly for mutation, then verify
-				time.Sleep(1 * time.Second)
-				var existsAfter int
-				err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+chConfig.Database+"."+tableName+" WHERE key = ?", fullDeleteKey).Scan(&existsAfter)
-				if err == nil && existsAfter == 0 {
-					fmt.Printf("✓ Key %s deleted successfully\n", deleteKey)
-				} else {
-					log.Printf("❌ Key %s still exists after deletion", deleteKey)
-				}
-			}
-		}
+// Artifacts lists the test rows in the distributed table, grouped by run.
+// The tables are shared by every run, which may be between creating them
+// and inserting, so they are listed only when sweeping every run and
+// nothing would be left in them once those rows are gone. Missing tables
+// hold nothing.
+func (c *clickHouseChecker) Artifacts(ctx context.Context, before time.Time) ([]Artifact, error) {
+	distTable := c.table + "_dist"
+	startKey, endKey := c.keys.testRange("")
+	rows, err := c.db.QueryContext(ctx, fmt.Sprintf("SELECT key FROM %s WHERE key >= ? AND key < ? ORDER BY key", distTable), startKey, endKey)
+	var ex *clickhouse.Exception
+	if errors.As(err, &ex) && (ex.Code == 60 || ex.Code == 81) { // UNKNOWN_TABLE, UNKNOWN_DATABASE
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list test rows: %w", err)
+	}
+	defer rows.Close()
 
-		// 6. CLEANUP - Delete remaining test keys
-		fmt.Println("6. Cleaning up test keys...")
-		for _, item := range testItems {
-			if item.Key == "" {
-				continue
-			}
-			// Skip the key we're keeping for final verification
-			if strings.Contains(item.Key, "2") {
-				continue
-			}
-
-			fullCleanupKey := addPrefix(item.Key)
-			cleanupSQL := fmt.Sprintf("ALTER TABLE %s.%s DELETE WHERE key = ?", chConfig.Database, tableName)
-			_, err = db.ExecContext(ctx, cleanupSQL, fullCleanupKey)
-			if err != nil {
-				log.Printf("⚠️ Cleanup warning for %s: %v", item.Key, err)
-			}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
 		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	found := c.keys.artifacts("rows", keys, before)
 
-		// Final verification - check one key still exists
-		finalCheckKey := baseKey + "_3"
-		var checkValue string
-		err = db.QueryRowContext(ctx, "SELECT value FROM "+chConfig.Database+"."+tableName+" WHERE key = ?", addPrefix(finalCheckKey)).Scan(&checkValue)
-		if err == nil && checkValue != "" {
-			fmt.Printf("✓ Final verification: key %s still exists with value %s\n", finalCheckKey, checkValue)
-		}
+	var others uint64
+	if err := c.db.QueryRowContext(ctx, fmt.Sprintf("SELECT count() FROM %s WHERE NOT (key >= ? AND key < ?)", distTable), startKey, endKey).Scan(&others); err != nil {
+		return nil, fmt.Errorf("count rows: %w", err)
+	}
+	if sweepTables(before, found, len(keys), others) {
+		found = append(found,
+			Artifact{Kind: "table", Name: distTable},
+			Artifact{Kind: "table", Name: c.table},
+		)
+	}
+	return found, nil
+}
+
+// sweepTables reports whether the shared tables go along with the found
+// rows: only when sweeping every run, and when the found rows are all the
+// test rows and no other rows are left.
+func sweepTables(before time.Time, found []Artifact, testRows int, others uint64) bool {
+	swept := 0
+	for _, a := range found {
+		swept += len(a.Keys)
+	}
+	return before.IsZero() && others == 0 && swept == testRows
+}
+
+func (c *clickHouseChecker) Remove(ctx context.Context, a Artifact) error {
+	if a.Kind == "table" {
+		_, err := c.db.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s ON CLUSTER '%s' SYNC", a.Name, "{cluster}"))
+		return err
+	}
+	deleteSQL := fmt.Sprintf("ALTER TABLE %s ON CLUSTER '%s' DELETE WHERE has(?, key)", c.table, "{cluster}")
+	_, err := c.db.ExecContext(ctx, deleteSQL, a.Keys)
+	return err
+}
+
+func (c *clickHouseChecker) Close() error {
+	return c.db.Close()
+}
+
+// clickHouseTransientCodes are the server error codes caused by load or the
+// network rather than by the request.
+var clickHouseTransientCodes = []int32{
+	159, // TIMEOUT_EXCEEDED
+	202, // TOO_MANY_SIMULTANEOUS_QUERIES
+	203, // NO_FREE_CONNECTION
+	209, // SOCKET_TIMEOUT
+	210, // NETWORK_ERROR
+	225, // NO_ZOOKEEPER
+	242, // TABLE_IS_READ_ONLY
+	252, // TOO_MANY_PARTS
+	319, // UNKNOWN_STATUS_OF_INSERT
+	999, // KEEPER_EXCEPTION
+}
 
-		fmt.Printf("✅ ClickHouse %d test completed\n", i+1)
+// Transient retries the server errors in clickHouseTransientCodes. Others,
+// such as AUTHENTICATION_FAILED (516) or UNKNOWN_TABLE (60), are permanent.
+func (c *clickHouseChecker) Transient(err error) bool {
+	var ex *clickhouse.Exception
+	if errors.As(err, &ex) {
+		return slices.Contains(clickHouseTransientCodes, ex.Code)
 	}
+	return transient(err)
 }
@@ -2,175 +2,453 @@ package service
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"data-check-all/model"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v9"
 	"github.com/elastic/go-elasticsearch/v9/esapi"
 	"io"
-
-	// "net/http"
-	// "errors"
-	"data-check-all/model"
+	"maps"
+	"net/http"
+	"slices"
 	"strings"
 	"time"
-	"log"
 )
 
-func TestES(ess []model.ESConfig) {
-	ctx := context.Background()
+func init() {
+	Register("es", "Elasticsearch", newESChecker)
+}
 
-	for i, esConfig := range ess {
-		fmt.Printf("\n=== Testing Elasticsearch %d: %s:%d ===\n", i+1, esConfig.Host, esConfig.Port)
+// indexPrefix starts the name of every index the checker creates, followed
+// by the run ID.
+const indexPrefix = "datacheck-"
 
-		// Create client
-		addresses := []string{fmt.Sprintf("https://%s:%d", esConfig.Host, esConfig.Port)}
-		cfg := elasticsearch.Config{
-			Addresses: addresses,
-			Username:  esConfig.Username,
-			Password:  esConfig.Password,
-		}
+// legacyIndex is the fixed index created before indices were per run.
+const legacyIndex = "test-1"
 
-		client, err := elasticsearch.NewClient(cfg)
-		if err != nil {
-			log.Printf("❌ Failed to create client: %v", err)
-			continue
-		}
+// bulkSuffix ends the name of the index of the bulk step, after the run ID.
+const bulkSuffix = "-bulk"
+
+// esMapping is the mapping of the indices of a run, fitting TestDocument.
+const esMapping = `{"mappings":{"properties":{"name":{"type":"text","fields":{"keyword":{"type":"keyword"}}},"value":{"type":"integer"},"timestamp":{"type":"date"}}}}`
 
-		indexName := "test-1"
+type esChecker struct {
+	cfg    model.ESConfig
+	client *elasticsearch.Client
+	nodes  []esNode // every known node, for the per-node check
+	// transport is shared by every client of the checker, from Connect to
+	// Close.
+	transport *http.Transport
+	version   string
+	index     string
+	docs      []model.TestDocument
+	// deleteSent is the index the delete step last sent its request to,
+	// so a retry after a timeout accepts the document already gone.
+	deleteSent string
+}
+
+func newESChecker(cfg model.ESConfig) Checker {
+	return &esChecker{cfg: cfg}
+}
+
+func (c *esChecker) Addr() string {
+	if len(c.cfg.Addresses) > 0 {
+		return strings.Join(c.cfg.Addresses, ",")
+	}
+	return fmt.Sprintf("%s:%d", c.cfg.Host, c.cfg.Port)
+}
+
+func (c *esChecker) scheme() string {
+	return cmp.Or(c.cfg.Scheme, "https")
+}
 
-		// 1. CREATE INDEX
-		fmt.Println("1. Creating index...")
-		createReq := esapi.IndicesCreateRequest{
-			Index: indexName,
-			Body:  strings.NewReader(`{"mappings":{"properties":{"name":{"type":"text"},"value":{"type":"integer"},"timestamp":{"type":"date"}}}}`),
+// tlsConfig returns the TLS settings for https: the CA bundle, or else the
+// system trust store, and the client certificate if one is set.
+func (c *esChecker) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         c.cfg.SSLServerName,
+		InsecureSkipVerify: c.cfg.SSLInsecure,
+	}
+	if c.cfg.SSLCACRT != "" {
+		caPEM, err := loadCertFromFile(c.cfg.SSLCACRT)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CA: %w", err)
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificate found in CA %s", c.cfg.SSLCACRT)
 		}
-		createRes, err := createReq.Do(ctx, client)
+		tlsConfig.RootCAs = caCertPool
+	}
+	if c.cfg.SSLClientCRT != "" {
+		certPEM, err := loadCertFromFile(c.cfg.SSLClientCRT)
 		if err != nil {
-			log.Printf("❌ Create index error: %v", err)
-			continue
+			return nil, fmt.Errorf("failed to load client cert: %w", err)
 		}
-		defer createRes.Body.Close()
-
-		if createRes.IsError() {
-			log.Printf("❌ Create index failed: %s", createRes.Status())
-			continue
+		keyPEM, err := loadCertFromFile(c.cfg.SSLClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client key: %w", err)
 		}
-		fmt.Println("✓ Index 'test-1' created successfully")
-
-		// 2. CREATE (Insert) Documents
-		fmt.Println("2. Inserting test documents...")
-		testDocs := []model.TestDocument{
-			{ID: "1", Name: "Document One", Value: 100, Ts: time.Now()},
-			{ID: "2", Name: "Document Two", Value: 200, Ts: time.Now()},
-			{ID: "3", Name: "Document Three", Value: 300, Ts: time.Now()},
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse client cert/key: %w", err)
 		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
 
-		for _, doc := range testDocs {
-			docJSON, _ := json.Marshal(doc)
-			createDocReq := esapi.IndexRequest{
-				Index:      indexName,
-				DocumentID: doc.ID,
-				Body:       bytes.NewReader(docJSON),
-				Refresh:    "true", // Make document immediately searchable
-			}
-			res, err := createDocReq.Do(ctx, client)
+// clientConfig returns the settings of a client sending requests to the
+// given URLs, with the credentials and TLS settings of the target.
+func (c *esChecker) clientConfig(urls []string) (elasticsearch.Config, error) {
+	cfg := elasticsearch.Config{
+		Addresses:    urls,
+		Username:     c.cfg.Username,
+		Password:     c.cfg.Password,
+		APIKey:       c.cfg.APIKey,
+		ServiceToken: c.cfg.ServiceToken,
+	}
+	if c.cfg.BearerToken != "" {
+		cfg.Header = http.Header{"Authorization": {"Bearer " + c.cfg.BearerToken}}
+	}
+	if c.transport == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if c.scheme() == "https" {
+			tlsConfig, err := c.tlsConfig()
 			if err != nil {
-				log.Printf("❌ Insert document %s error: %v", doc.ID, err)
-				continue
-			}
-			defer res.Body.Close()
-
-			if res.IsError() {
-				log.Printf("❌ Insert document %s failed: %s", doc.ID, res.Status())
-			} else {
-				fmt.Printf("✓ Document %s inserted\n", doc.ID)
+				return cfg, err
 			}
+			transport.TLSClientConfig = tlsConfig
 		}
+		c.transport = transport
+	}
+	cfg.Transport = c.transport
+	return cfg, nil
+}
 
-		// 3. READ (Search) Documents
-		fmt.Println("3. Reading documents...")
-		searchReq := esapi.SearchRequest{
-			Index: []string{indexName},
-			Body:  strings.NewReader(`{"query":{"match_all":{}}}`),
-			Size:  &[]int{10}[0],
-		}
-		searchRes, err := searchReq.Do(ctx, client)
-		if err != nil {
-			log.Printf("❌ Search error: %v", err)
-		} else {
-			defer searchRes.Body.Close()
-			if searchRes.IsError() {
-				log.Printf("❌ Search failed: %s", searchRes.Status())
-			} else {
-				body, _ := io.ReadAll(searchRes.Body)
-				fmt.Printf("✓ Found %d documents: %s\n",
-					len(testDocs), string(body[:min(100, len(body))])+"...")
-			}
+func (c *esChecker) newClient(urls []string) (*elasticsearch.Client, error) {
+	cfg, err := c.clientConfig(urls)
+	if err != nil {
+		return nil, err
+	}
+	client, err := elasticsearch.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	return client, nil
+}
+
+func (c *esChecker) Connect(ctx context.Context) error {
+	logf(ctx, "Connecting to Elasticsearch at %s (TLS: %v)", c.Addr(), c.scheme() == "https")
+
+	c.Close() // certificates are read again on every connect
+	if err := c.setNodes(c.configuredNodes()); err != nil {
+		return err
+	}
+
+	// Ask for the cluster info so an unreachable node fails here
+	res, err := c.client.Info(c.client.Info.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return statusError(res)
+	}
+	var info struct {
+		Version struct {
+			Number string `json:"number"`
+		} `json:"version"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return fmt.Errorf("decode cluster info: %w", err)
+	}
+	c.version = info.Version.Number
+	logf(ctx, "✓ Connected to Elasticsearch %s", c.version)
+
+	// Discovery needs the monitor privilege, which a user checking CRUD
+	// may lack; the configured nodes still serve every step
+	if c.cfg.Discover {
+		if err := c.discover(ctx); err != nil {
+			logf(ctx, "⚠️ %v; using %s", err, c.Addr())
 		}
+	}
+	return nil
+}
 
-		// 4. UPDATE Document
-		fmt.Println("4. Updating document...")
-		updatedDoc := model.TestDocument{ID: "1", Name: "Updated Document One", Value: 150, Ts: time.Now()}
+func (c *esChecker) Version() string {
+	return c.version
+}
 
-		docJSON, err := json.Marshal(updatedDoc)
-		if err != nil {
-			log.Printf("❌ JSON marshal error for update: %v", err)
+func (c *esChecker) SetRunID(id string) {
+	c.index = ""
+	if id != "" {
+		c.index = indexPrefix + id
+	}
+}
+
+func (c *esChecker) Steps() []Step {
+	steps := append(c.healthSteps(), []Step{
+		{Name: "create_index", Title: "Creating index", Run: c.createIndex, Required: true},
+		{Name: "insert", Title: "Inserting test documents", Run: c.insert},
+		{Name: "read", Title: "Reading documents", Run: c.read, Needs: []string{"insert"}},
+		{Name: "query", Title: "Checking term, range and aggregation queries", Run: c.query, Needs: []string{"insert"}},
+		{Name: "update", Title: "Updating document", Run: c.update, Needs: []string{"insert"}},
+		{Name: "delete", Title: "Deleting document", Run: c.delete, Needs: []string{"insert"}},
+	}...)
+	if c.cfg.Bulk.Docs > 0 {
+		steps = append(steps, Step{Name: "bulk", Title: "Bulk indexing", Run: c.bulk})
+	}
+	if c.cfg.PerNode {
+		steps = append(steps, Step{Name: "nodes", Title: "Checking every node", Run: c.checkNodes})
+	}
+	return steps
+}
+
+func (c *esChecker) createIndex(ctx context.Context) error {
+	onTeardown(ctx, "delete_index", c.dropIndex(c.index))
+	if err := c.newIndex(ctx, c.index); err != nil {
+		return err
+	}
+	printf(ctx, "✓ Index '%s' created successfully\n", c.index)
+	return nil
+}
+
+// newIndex creates index with the mapping of the run. The index is named
+// after the run, so one that already exists was created by an earlier
+// attempt whose answer timed out, and is kept.
+func (c *esChecker) newIndex(ctx context.Context, index string) error {
+	err := c.do(ctx, esapi.IndicesCreateRequest{Index: index, Body: strings.NewReader(esMapping)})
+	var se *esStatusError
+	if errors.As(err, &se) && se.code == http.StatusBadRequest && strings.Contains(se.reason, "already exists") {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("create index %s: %w", index, err)
+	}
+	return nil
+}
+
+func (c *esChecker) insert(ctx context.Context) error {
+	// A second apart, at the millisecond precision of date fields, so
+	// range queries on timestamp can tell them apart
+	start := time.Now().UTC().Truncate(time.Millisecond)
+	docs := []model.TestDocument{
+		{ID: "1", Name: "Document One", Value: 100, Ts: start},
+		{ID: "2", Name: "Document Two", Value: 200, Ts: start.Add(time.Second)},
+		{ID: "3", Name: "Document Three", Value: 300, Ts: start.Add(2 * time.Second)},
+	}
+
+	c.docs = nil // the checker may be reused across runs
+	var errs []error
+	for _, doc := range docs {
+		if err := c.indexDoc(ctx, doc); err != nil {
+			errs = append(errs, fmt.Errorf("insert document %s: %w", doc.ID, err))
 			continue
 		}
-		updateReq := esapi.IndexRequest{
-			Index:      indexName,
-			DocumentID: "1",
-			Body:       bytes.NewReader(docJSON),
-			Refresh:    "true",
-		}
-		updateRes, err := updateReq.Do(ctx, client)
-		if err != nil {
-			log.Printf("❌ Update error: %v", err)
-		} else {
-			defer updateRes.Body.Close()
-			if updateRes.IsError() {
-				log.Printf("❌ Update failed: %s", updateRes.Status())
-			} else {
-				fmt.Println("✓ Document 1 updated successfully")
-			}
-		}
+		c.docs = append(c.docs, doc)
+		printf(ctx, "✓ Document %s inserted\n", doc.ID)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *esChecker) read(ctx context.Context) error {
+	if len(c.docs) == 0 {
+		return errors.New("no documents were inserted")
+	}
+	hits, err := c.search(ctx, map[string]any{"query": map[string]any{"match_all": map[string]any{}}})
+	if err != nil {
+		return err
+	}
+	if err := compareDocs(hits.docs(), c.docs); err != nil {
+		return err
+	}
+	printf(ctx, "✓ Found the %d documents inserted, with their contents\n", len(c.docs))
+	return nil
+}
+
+func (c *esChecker) update(ctx context.Context) error {
+	doc := model.TestDocument{ID: "1", Name: "Updated Document One", Value: 150, Ts: time.Now()}
+	if err := c.indexDoc(ctx, doc); err != nil {
+		return err
+	}
+	printf(ctx, "✓ Document %s updated successfully\n", doc.ID)
+	return nil
+}
 
-		// 5. DELETE Document
-		fmt.Println("5. Deleting document...")
-		deleteReq := esapi.DeleteRequest{
-			Index:      indexName,
-			DocumentID: "2",
+func (c *esChecker) delete(ctx context.Context) error {
+	retry := c.deleteSent == c.index
+	c.deleteSent = c.index
+	req := esapi.DeleteRequest{
+		Index:      c.index,
+		DocumentID: "2",
+	}
+	err := c.do(ctx, req)
+	var se *esStatusError
+	if retry && errors.As(err, &se) && se.code == http.StatusNotFound {
+		err = nil // deleted by the attempt that timed out
+	}
+	if err != nil {
+		return err
+	}
+	printf(ctx, "✓ Document 2 deleted successfully\n")
+	return nil
+}
+
+// dropIndex returns the teardown deleting the index of the run, if it was
+// created.
+func (c *esChecker) dropIndex(index string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		err := c.deleteIndex(ctx, index)
+		var se *esStatusError
+		if errors.As(err, &se) && se.code == http.StatusNotFound {
+			return nil
 		}
-		deleteRes, err := deleteReq.Do(ctx, client)
 		if err != nil {
-			log.Printf("❌ Delete error: %v", err)
-		} else {
-			defer deleteRes.Body.Close()
-			if deleteRes.IsError() {
-				log.Printf("❌ Delete failed: %s", deleteRes.Status())
-			} else {
-				fmt.Println("✓ Document 2 deleted successfully")
-			}
+			return err
 		}
+		printf(ctx, "✓ Index '%s' deleted successfully\n", index)
+		return nil
+	}
+}
 
-		// 6. DELETE INDEX (Cleanup)
-		fmt.Println("6. Cleaning up - deleting index...")
-		deleteIndexReq := esapi.IndicesDeleteRequest{
-			Index: []string{indexName},
-		}
-		deleteIndexRes, err := deleteIndexReq.Do(ctx, client)
-		if err != nil {
-			log.Printf("❌ Delete index error: %v", err)
-		} else {
-			defer deleteIndexRes.Body.Close()
-			if deleteIndexRes.IsError() {
-				log.Printf("❌ Delete index failed: %s", deleteIndexRes.Status())
-			} else {
-				fmt.Println("✓ Index 'test-1' deleted successfully")
-			}
+func (c *esChecker) deleteIndex(ctx context.Context, index string) error {
+	if err := c.do(ctx, esapi.IndicesDeleteRequest{Index: []string{index}}); err != nil {
+		return fmt.Errorf("delete index %s: %w", index, err)
+	}
+	return nil
+}
+
+// Artifacts lists the indices created by every run, oldest first, and the
+// legacy index.
+func (c *esChecker) Artifacts(ctx context.Context, before time.Time) ([]Artifact, error) {
+	yes := true
+	req := esapi.IndicesGetRequest{
+		Index:             []string{indexPrefix + "*", legacyIndex},
+		IgnoreUnavailable: &yes,
+		AllowNoIndices:    &yes,
+		FilterPath:        []string{"*.settings.index.provided_name"},
+	}
+	res, err := req.Do(ctx, c.client)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, statusError(res)
+	}
+	var indices map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, fmt.Errorf("decode indices: %w", err)
+	}
+
+	var found []Artifact
+	for _, index := range slices.Sorted(maps.Keys(indices)) {
+		runID := indexRunID(index)
+		if sweepable(runID, before) {
+			found = append(found, Artifact{Kind: "index", Name: index, RunID: runID})
 		}
+	}
+	return found, nil
+}
 
-		fmt.Printf("✅ Elasticsearch %d test completed\n", i+1)
+// indexRunID returns the run ID in the name of a test index, or "" for the
+// legacy index.
+func indexRunID(index string) string {
+	if index == legacyIndex {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(index, indexPrefix), bulkSuffix)
+}
+
+func (c *esChecker) Remove(ctx context.Context, a Artifact) error {
+	return c.deleteIndex(ctx, a.Name)
+}
+
+// Close closes the idle connections of every client of the checker.
+func (c *esChecker) Close() error {
+	if c.transport != nil {
+		c.transport.CloseIdleConnections()
+		c.transport = nil
+	}
+	return nil
+}
+
+func (c *esChecker) indexDoc(ctx context.Context, doc model.TestDocument) error {
+	docJSON, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, esapi.IndexRequest{
+		Index:      c.index,
+		DocumentID: doc.ID,
+		Body:       bytes.NewReader(docJSON),
+		Refresh:    "true", // Make document immediately searchable
+	})
+}
+
+// do sends req and turns an error status into an error.
+func (c *esChecker) do(ctx context.Context, req esapi.Request) error {
+	return send(ctx, c.client, req)
+}
+
+// send sends req through client and turns an error status into an error.
+func send(ctx context.Context, client esapi.Transport, req esapi.Request) error {
+	res, err := req.Do(ctx, client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return statusError(res)
+	}
+	return nil
+}
+
+// esStatusError is an error status returned by Elasticsearch.
+type esStatusError struct {
+	code   int
+	status string
+	reason string // from the error body, if any
+}
+
+func (e *esStatusError) Error() string {
+	if e.reason != "" {
+		return e.status + ": " + e.reason
+	}
+	return e.status
+}
+
+// Is makes 401 and 403 match ErrAuth.
+func (e *esStatusError) Is(target error) bool {
+	return target == ErrAuth && (e.code == http.StatusUnauthorized || e.code == http.StatusForbidden)
+}
+
+func statusError(res *esapi.Response) error {
+	var body struct {
+		Error struct {
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&body)
+	return &esStatusError{code: res.StatusCode, status: res.Status(), reason: body.Error.Reason}
+}
+
+// Transient treats throttling (429) and unavailable nodes (502, 503, 504)
+// as worth retrying, and every other error status as permanent.
+func (c *esChecker) Transient(err error) bool {
+	var se *esStatusError
+	if errors.As(err, &se) {
+		switch se.code {
+		case 429, 502, 503, 504:
+			return true
+		}
+		return false
 	}
+	return transient(err)
 }
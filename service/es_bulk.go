@@ -0,0 +1,199 @@
+package service
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"data-check-all/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v9/esapi"
+	"github.com/elastic/go-elasticsearch/v9/esutil"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// bulkTransport counts the bulk requests that failed as a whole, and those
+// Elasticsearch rejected with 429. The bulk indexer reports them as plain
+// errors, more than once each.
+type bulkTransport struct {
+	esapi.Transport
+	failed   atomic.Int64
+	rejected atomic.Int64
+}
+
+func (t *bulkTransport) Perform(req *http.Request) (*http.Response, error) {
+	res, err := t.Transport.Perform(req)
+	if err != nil || res.StatusCode >= 400 {
+		t.failed.Add(1)
+	}
+	if err == nil && res.StatusCode == http.StatusTooManyRequests {
+		t.rejected.Add(1)
+	}
+	return res, err
+}
+
+// bulkFailures collects the documents the bulk indexer could not index.
+type bulkFailures struct {
+	mu       sync.Mutex
+	items    int
+	rejected int            // items rejected with 429
+	reasons  map[string]int // failed items by error type
+	first    map[string]string
+	err      error // first error of the indexer, such as a failed request
+}
+
+func (f *bulkFailures) item(res esutil.BulkIndexerResponseItem, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items++
+	if res.Status == http.StatusTooManyRequests {
+		f.rejected++
+	}
+	kind, reason := res.Error.Type, res.Error.Reason
+	if err != nil {
+		kind, reason = "error", err.Error()
+	}
+	if f.reasons[kind]++; f.reasons[kind] == 1 {
+		f.first[kind] = reason
+	}
+}
+
+func (f *bulkFailures) request(_ context.Context, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+// bulk indexes the configured number of generated documents into an index
+// of their own through the bulk indexer, reports the rate and failures, and
+// checks the index holds every document.
+func (c *esChecker) bulk(ctx context.Context) error {
+	index := c.index + bulkSuffix
+	if err := c.createBulkIndex(ctx, index); err != nil {
+		return err
+	}
+
+	transport := &bulkTransport{Transport: c.client}
+	failures := &bulkFailures{reasons: make(map[string]int), first: make(map[string]string)}
+	bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client:     transport,
+		Index:      index,
+		NumWorkers: c.cfg.Bulk.Workers,
+		FlushBytes: c.cfg.Bulk.FlushBytes,
+		OnError:    failures.request,
+		// The workers flush with a context of their own, which would let a
+		// stalled request outlive the step timeout
+		OnFlushStart: func(context.Context) context.Context { return ctx },
+	})
+	if err != nil {
+		return fmt.Errorf("create bulk indexer: %w", err)
+	}
+
+	// IDs do not change between attempts, so a retried step overwrites
+	// the documents of the failed attempt
+	base := time.Now().UTC().Truncate(time.Millisecond)
+	start := time.Now()
+	var addErr error
+	for i := range c.cfg.Bulk.Docs {
+		if addErr = ctx.Err(); addErr != nil {
+			break
+		}
+		doc := model.TestDocument{
+			ID:    fmt.Sprintf("bulk-%d", i),
+			Name:  fmt.Sprintf("Bulk Document %d", i),
+			Value: i,
+			Ts:    base.Add(time.Duration(i) * time.Millisecond),
+		}
+		body, err := json.Marshal(doc)
+		if err != nil {
+			addErr = err
+			break
+		}
+		if addErr = bi.Add(ctx, esutil.BulkIndexerItem{
+			Action:     "index",
+			DocumentID: doc.ID,
+			Body:       bytes.NewReader(body),
+			OnFailure: func(_ context.Context, _ esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+				failures.item(res, err)
+			},
+		}); addErr != nil {
+			break
+		}
+	}
+	closeErr := bi.Close(ctx)
+	took := time.Since(start)
+	if err := cmp.Or(addErr, closeErr); err != nil {
+		return fmt.Errorf("bulk index: %w", err)
+	}
+
+	stats := bi.Stats()
+	mark := "✓"
+	if int(stats.NumIndexed) != c.cfg.Bulk.Docs {
+		mark = "✗"
+	}
+	printf(ctx, "%s Indexed %d of %d documents in %s, %.0f docs/sec, %d requests\n",
+		mark, stats.NumIndexed, c.cfg.Bulk.Docs, took.Round(time.Millisecond),
+		float64(stats.NumIndexed)/took.Seconds(), stats.NumRequests)
+
+	var errs []error
+	if failures.rejected > 0 || transport.rejected.Load() > 0 {
+		printf(ctx, "⚠️ Rejected (429): %d documents, %d whole requests\n", failures.rejected, transport.rejected.Load())
+	}
+	if failures.items > 0 {
+		var counts []string
+		for _, kind := range slices.Sorted(maps.Keys(failures.reasons)) {
+			counts = append(counts, fmt.Sprintf("%s: %d", kind, failures.reasons[kind]))
+			printf(ctx, "  - %s: %s\n", kind, failures.first[kind])
+		}
+		errs = append(errs, fmt.Errorf("%d documents failed (%s)", failures.items, strings.Join(counts, ", ")))
+	}
+	switch n := transport.failed.Load(); {
+	case n > 0 && failures.err != nil:
+		errs = append(errs, fmt.Errorf("%d bulk requests failed, first: %w", n, failures.err))
+	case n > 0:
+		errs = append(errs, fmt.Errorf("%d bulk requests failed", n))
+	case failures.err != nil:
+		errs = append(errs, failures.err)
+	}
+
+	count, err := c.count(ctx, index)
+	switch {
+	case err != nil:
+		errs = append(errs, err)
+	case count != c.cfg.Bulk.Docs:
+		errs = append(errs, fmt.Errorf("index holds %d documents, want %d", count, c.cfg.Bulk.Docs))
+	default:
+		printf(ctx, "✓ Index holds all %d documents\n", count)
+	}
+	return errors.Join(errs...)
+}
+
+// createBulkIndex creates the index of the bulk step, keeping the one left
+// by an earlier attempt of the step.
+func (c *esChecker) createBulkIndex(ctx context.Context, index string) error {
+	onTeardown(ctx, "delete_bulk_index", c.dropIndex(index))
+	return c.newIndex(ctx, index)
+}
+
+// count refreshes index and returns the number of documents it holds.
+func (c *esChecker) count(ctx context.Context, index string) (int, error) {
+	if err := c.do(ctx, esapi.IndicesRefreshRequest{Index: []string{index}}); err != nil {
+		return 0, fmt.Errorf("refresh: %w", err)
+	}
+	var res struct {
+		Count int `json:"count"`
+	}
+	if err := c.getJSON(ctx, esapi.CountRequest{Index: []string{index}}, &res); err != nil {
+		return 0, fmt.Errorf("count: %w", err)
+	}
+	return res.Count, nil
+}
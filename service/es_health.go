@@ -0,0 +1,282 @@
+package service
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"data-check-all/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v9/esapi"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxExplained is the number of unassigned shards whose allocation is
+// explained.
+const maxExplained = 3
+
+// healthSteps are the read-only checks of the state of the cluster, when
+// enabled.
+func (c *esChecker) healthSteps() []Step {
+	if !c.cfg.Health.Enabled {
+		return nil
+	}
+	return []Step{
+		{Name: "health", Title: "Checking cluster health", Run: c.clusterHealth},
+		{Name: "shards", Title: "Checking unassigned shards", Run: c.unassignedShards},
+		{Name: "pending_tasks", Title: "Checking pending cluster tasks", Run: c.pendingTasks},
+		{Name: "disk", Title: "Checking disk watermarks", Run: c.diskWatermarks},
+	}
+}
+
+// getJSON sends req and decodes the answer into v.
+func (c *esChecker) getJSON(ctx context.Context, req esapi.Request, v any) error {
+	res, err := req.Do(ctx, c.client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return statusError(res)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+func (c *esChecker) clusterHealth(ctx context.Context) error {
+	var health struct {
+		Status           string  `json:"status"`
+		Nodes            int     `json:"number_of_nodes"`
+		Unassigned       int     `json:"unassigned_shards"`
+		ActiveShardsPerc float64 `json:"active_shards_percent_as_number"`
+	}
+	if err := c.getJSON(ctx, esapi.ClusterHealthRequest{}, &health); err != nil {
+		return err
+	}
+	summary := fmt.Sprintf("Cluster is %s (%d nodes, %.1f%% of shards active)", health.Status, health.Nodes, health.ActiveShardsPerc)
+	switch {
+	case health.Status == "green":
+	case health.Status == "yellow" && c.cfg.Health.AllowYellow:
+		printf(ctx, "⚠️ %s; yellow is allowed\n", summary)
+		return nil
+	default:
+		return fmt.Errorf("cluster status is %s with %d unassigned shards", health.Status, health.Unassigned)
+	}
+	printf(ctx, "✓ %s\n", summary)
+	return nil
+}
+
+type esShard struct {
+	Index   string `json:"index"`
+	Shard   string `json:"shard"`
+	PriRep  string `json:"prirep"`
+	State   string `json:"state"`
+	Reason  string `json:"unassigned.reason"`
+	primary bool
+}
+
+func (c *esChecker) unassignedShards(ctx context.Context) error {
+	var shards []esShard
+	req := esapi.CatShardsRequest{Format: "json", H: []string{"index", "shard", "prirep", "state", "unassigned.reason"}}
+	if err := c.getJSON(ctx, req, &shards); err != nil {
+		return err
+	}
+	var unassigned []esShard
+	reasons := make(map[string]int)
+	for _, s := range shards {
+		if s.State == "UNASSIGNED" {
+			s.primary = s.PriRep == "p"
+			unassigned = append(unassigned, s)
+			reasons[s.Reason]++
+		}
+	}
+	if len(unassigned) == 0 {
+		printf(ctx, "✓ All %d shards assigned\n", len(shards))
+		return nil
+	}
+
+	var counts []string
+	for _, reason := range slices.Sorted(maps.Keys(reasons)) {
+		counts = append(counts, fmt.Sprintf("%s: %d", reason, reasons[reason]))
+	}
+	printf(ctx, "%d of %d shards unassigned (%s)\n", len(unassigned), len(shards), strings.Join(counts, ", "))
+	// Primaries first: a missing primary loses data, a replica redundancy
+	slices.SortStableFunc(unassigned, func(a, b esShard) int {
+		switch {
+		case a.primary == b.primary:
+			return 0
+		case a.primary:
+			return -1
+		}
+		return 1
+	})
+	for _, s := range unassigned[:min(maxExplained, len(unassigned))] {
+		printf(ctx, "  - %s\n", c.explain(ctx, s))
+	}
+
+	if len(unassigned) > c.cfg.Health.MaxUnassignedShards {
+		return fmt.Errorf("%d unassigned shards, more than the %d allowed (%s)",
+			len(unassigned), c.cfg.Health.MaxUnassignedShards, strings.Join(counts, ", "))
+	}
+	printf(ctx, "✓ Within the %d unassigned shards allowed\n", c.cfg.Health.MaxUnassignedShards)
+	return nil
+}
+
+// explain describes why the shard is unassigned, from the allocation
+// explain API.
+func (c *esChecker) explain(ctx context.Context, s esShard) string {
+	kind := "replica"
+	if s.primary {
+		kind = "primary"
+	}
+	name := fmt.Sprintf("%s[%s] %s", s.Index, s.Shard, kind)
+
+	shard, _ := strconv.Atoi(s.Shard)
+	body, err := json.Marshal(map[string]any{"index": s.Index, "shard": shard, "primary": s.primary})
+	if err != nil {
+		return name + ": " + err.Error()
+	}
+	var explanation struct {
+		Info struct {
+			Reason  string `json:"reason"`
+			Details string `json:"details"`
+		} `json:"unassigned_info"`
+		Explanation string `json:"allocate_explanation"`
+	}
+	if err := c.getJSON(ctx, esapi.ClusterAllocationExplainRequest{Body: bytes.NewReader(body)}, &explanation); err != nil {
+		return fmt.Sprintf("%s: %s (explain failed: %v)", name, s.Reason, err)
+	}
+	parts := []string{name, explanation.Info.Reason}
+	if explanation.Info.Details != "" {
+		parts = append(parts, explanation.Info.Details)
+	}
+	if explanation.Explanation != "" {
+		parts = append(parts, explanation.Explanation)
+	}
+	return strings.Join(parts, ": ")
+}
+
+func (c *esChecker) pendingTasks(ctx context.Context) error {
+	var pending struct {
+		Tasks []struct {
+			Priority string `json:"priority"`
+			Source   string `json:"source"`
+			WaitMS   int64  `json:"time_in_queue_millis"`
+		} `json:"tasks"`
+	}
+	if err := c.getJSON(ctx, esapi.ClusterPendingTasksRequest{}, &pending); err != nil {
+		return err
+	}
+	if len(pending.Tasks) == 0 {
+		printf(ctx, "✓ No pending cluster tasks\n")
+		return nil
+	}
+	oldest := pending.Tasks[0]
+	for _, t := range pending.Tasks {
+		if t.WaitMS > oldest.WaitMS {
+			oldest = t
+		}
+	}
+	wait := time.Duration(oldest.WaitMS) * time.Millisecond
+	limit := cmp.Or(c.cfg.Health.MaxTaskWait, model.DefaultMaxTaskWait)
+	if wait > limit {
+		return fmt.Errorf("%d pending cluster tasks; %s task %q waited %s, over %s",
+			len(pending.Tasks), oldest.Priority, oldest.Source, wait, limit)
+	}
+	printf(ctx, "✓ %d pending cluster tasks, the oldest queued for %s\n", len(pending.Tasks), wait)
+	return nil
+}
+
+// esWatermarks are the disk watermarks of the cluster, in percent of disk
+// used. A watermark set as an absolute free size is 0.
+type esWatermarks struct {
+	low, high, flood float64
+}
+
+func (c *esChecker) watermarks(ctx context.Context) (esWatermarks, error) {
+	yes := true
+	var settings map[string]map[string]any
+	req := esapi.ClusterGetSettingsRequest{IncludeDefaults: &yes, FlatSettings: &yes}
+	if err := c.getJSON(ctx, req, &settings); err != nil {
+		return esWatermarks{}, err
+	}
+	// Transient settings override persistent ones, which override defaults
+	setting := func(name string) float64 {
+		key := "cluster.routing.allocation.disk.watermark." + name
+		for _, scope := range []string{"transient", "persistent", "defaults"} {
+			if v, ok := settings[scope][key].(string); ok {
+				return percentUsed(v)
+			}
+		}
+		return 0
+	}
+	return esWatermarks{low: setting("low"), high: setting("high"), flood: setting("flood_stage")}, nil
+}
+
+// percentUsed parses a watermark such as "85%" or "0.85", or returns 0 for
+// an absolute size such as "500mb".
+func percentUsed(watermark string) float64 {
+	if p, ok := strings.CutSuffix(watermark, "%"); ok {
+		v, _ := strconv.ParseFloat(p, 64)
+		return v
+	}
+	if v, err := strconv.ParseFloat(watermark, 64); err == nil && v <= 1 {
+		return v * 100
+	}
+	return 0
+}
+
+func (c *esChecker) diskWatermarks(ctx context.Context) error {
+	wm, err := c.watermarks(ctx)
+	if err != nil {
+		return fmt.Errorf("get watermarks: %w", err)
+	}
+	if wm.high == 0 {
+		printf(ctx, "✓ Watermarks are absolute sizes; disk use not compared\n")
+		return nil
+	}
+
+	var stats struct {
+		Nodes map[string]struct {
+			Name string `json:"name"`
+			FS   struct {
+				Total struct {
+					Total     int64 `json:"total_in_bytes"`
+					Available int64 `json:"available_in_bytes"`
+				} `json:"total"`
+			} `json:"fs"`
+		} `json:"nodes"`
+	}
+	if err := c.getJSON(ctx, esapi.NodesStatsRequest{Metric: []string{"fs"}}, &stats); err != nil {
+		return fmt.Errorf("get node stats: %w", err)
+	}
+
+	margin := cmp.Or(c.cfg.Health.DiskMargin, model.DefaultDiskMargin)
+	var errs []error
+	for _, id := range slices.Sorted(maps.Keys(stats.Nodes)) {
+		n := stats.Nodes[id]
+		total := n.FS.Total.Total
+		if total == 0 {
+			continue // no data path, e.g. a dedicated coordinating node
+		}
+		used := 100 * float64(total-n.FS.Total.Available) / float64(total)
+		switch {
+		case wm.flood > 0 && used >= wm.flood:
+			errs = append(errs, fmt.Errorf("node %s disk %.1f%% used, past the flood stage watermark %g%%; its indices are read-only", n.Name, used, wm.flood))
+		case used >= wm.high-margin:
+			errs = append(errs, fmt.Errorf("node %s disk %.1f%% used, within %g points of the high watermark %g%%", n.Name, used, margin, wm.high))
+		case wm.low > 0 && used >= wm.low:
+			printf(ctx, "⚠️ Node %s disk %.1f%% used, past the low watermark %g%%; no new shards go there\n", n.Name, used, wm.low)
+		default:
+			printf(ctx, "✓ Node %s disk %.1f%% used\n", n.Name, used)
+		}
+	}
+	return errors.Join(errs...)
+}
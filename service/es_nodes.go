@@ -0,0 +1,208 @@
+package service
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"data-check-all/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/elastic/go-elasticsearch/v9/esapi"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// esNode is an Elasticsearch node requests can be sent to.
+type esNode struct {
+	name   string // node name, or the address for configured nodes
+	url    string
+	client *elasticsearch.Client // to this node alone, with per_node
+}
+
+// configuredNodes returns the nodes of the config: every address, or else
+// host and port.
+func (c *esChecker) configuredNodes() []esNode {
+	addrs := c.cfg.Addresses
+	if len(addrs) == 0 {
+		addrs = []string{net.JoinHostPort(c.cfg.Host, strconv.Itoa(c.cfg.Port))}
+	}
+	nodes := make([]esNode, len(addrs))
+	for i, addr := range addrs {
+		nodes[i] = esNode{name: addr, url: c.scheme() + "://" + addr}
+	}
+	return nodes
+}
+
+func nodeURLs(nodes []esNode) []string {
+	urls := make([]string, len(nodes))
+	for i, n := range nodes {
+		urls[i] = n.url
+	}
+	return urls
+}
+
+// discover replaces the configured nodes with every node the cluster
+// lists in _nodes/http, and spreads requests over them.
+func (c *esChecker) discover(ctx context.Context) error {
+	req := esapi.NodesInfoRequest{
+		Metric:     []string{"http"},
+		FilterPath: []string{"nodes.*.name", "nodes.*.http.publish_address"},
+	}
+	res, err := req.Do(ctx, c.client)
+	if err != nil {
+		return fmt.Errorf("discover nodes: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("discover nodes: %w", statusError(res))
+	}
+	var info struct {
+		Nodes map[string]struct {
+			Name string `json:"name"`
+			HTTP struct {
+				PublishAddress string `json:"publish_address"`
+			} `json:"http"`
+		} `json:"nodes"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return fmt.Errorf("decode nodes: %w", err)
+	}
+
+	var nodes []esNode
+	for _, n := range info.Nodes {
+		addr := n.HTTP.PublishAddress
+		if addr == "" {
+			continue // HTTP disabled on the node
+		}
+		// "hostname/ip:port" when the node publishes a hostname, which
+		// certificates are more likely to name
+		if host, ipPort, ok := strings.Cut(addr, "/"); ok {
+			_, port, _ := net.SplitHostPort(ipPort)
+			addr = net.JoinHostPort(host, port)
+		}
+		nodes = append(nodes, esNode{name: n.Name, url: c.scheme() + "://" + addr})
+	}
+	if len(nodes) == 0 {
+		logf(ctx, "⚠️ Discovery found no HTTP nodes; using %s", c.Addr())
+		return nil
+	}
+	slices.SortFunc(nodes, func(a, b esNode) int { return strings.Compare(a.name, b.name) })
+
+	if err := c.setNodes(nodes); err != nil {
+		return err
+	}
+	logf(ctx, "✓ Discovered %d nodes", len(nodes))
+	return nil
+}
+
+// setNodes sends requests to nodes from now on, spread over them, and
+// makes the client of each node for the per-node check.
+func (c *esChecker) setNodes(nodes []esNode) error {
+	client, err := c.newClient(nodeURLs(nodes))
+	if err != nil {
+		return err
+	}
+	if c.cfg.PerNode {
+		for i, n := range nodes {
+			cfg, err := c.clientConfig([]string{n.url})
+			if err != nil {
+				return err
+			}
+			cfg.DisableRetry = true // report the node as it is
+			if nodes[i].client, err = elasticsearch.NewClient(cfg); err != nil {
+				return fmt.Errorf("failed to create client for node %s: %w", n.name, err)
+			}
+		}
+	}
+	c.client = client
+	c.nodes = nodes
+	return nil
+}
+
+// checkNodes runs the round trip through every node at once, and fails
+// on the nodes that could not complete it or were slow.
+func (c *esChecker) checkNodes(ctx context.Context) error {
+	slow := cmp.Or(c.cfg.SlowNode, model.DefaultSlowNode)
+	errs := make([]error, len(c.nodes))
+	took := make([]time.Duration, len(c.nodes))
+	var wg sync.WaitGroup
+	for i, n := range c.nodes {
+		wg.Go(func() {
+			start := time.Now()
+			errs[i] = c.roundTrip(ctx, n)
+			took[i] = time.Since(start)
+		})
+	}
+	wg.Wait()
+
+	var failed []error
+	for i, n := range c.nodes {
+		d := took[i].Round(time.Millisecond)
+		switch {
+		case errs[i] != nil:
+			printf(ctx, "✗ Node %s (%s) failed after %s: %v\n", n.name, n.url, d, errs[i])
+			failed = append(failed, fmt.Errorf("node %s: %w", n.name, errs[i]))
+		case took[i] > slow:
+			printf(ctx, "✗ Node %s (%s) slow: %s\n", n.name, n.url, d)
+			failed = append(failed, fmt.Errorf("node %s slow: round trip took %s, over %s", n.name, d, slow))
+		default:
+			printf(ctx, "✓ Node %s (%s) answered in %s\n", n.name, n.url, d)
+		}
+	}
+	if len(failed) == 0 {
+		printf(ctx, "✓ All %d nodes passed\n", len(c.nodes))
+	}
+	return errors.Join(failed...)
+}
+
+// roundTrip indexes a document through the node alone, then searches for
+// it through the same node.
+func (c *esChecker) roundTrip(ctx context.Context, n esNode) error {
+	client := n.client
+	doc := model.TestDocument{ID: "node-" + n.name, Name: "Node " + n.name, Value: 1, Ts: time.Now()}
+	docJSON, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := send(ctx, client, esapi.IndexRequest{
+		Index:      c.index,
+		DocumentID: doc.ID,
+		Body:       bytes.NewReader(docJSON),
+		Refresh:    "true",
+	}); err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+
+	query, err := json.Marshal(map[string]any{"query": map[string]any{"ids": map[string]any{"values": []string{doc.ID}}}})
+	if err != nil {
+		return err
+	}
+	res, err := esapi.SearchRequest{Index: []string{c.index}, Body: bytes.NewReader(query)}.Do(ctx, client)
+	if err != nil {
+		return fmt.Errorf("search: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("search: %w", statusError(res))
+	}
+	var found struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&found); err != nil {
+		return fmt.Errorf("decode search: %w", err)
+	}
+	if found.Hits.Total.Value != 1 {
+		return fmt.Errorf("search found %d documents, want 1", found.Hits.Total.Value)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"data-check-all/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v9/esapi"
+	"slices"
+	"strings"
+	"time"
+)
+
+// esHits is the decoded answer to a search.
+type esHits struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Source model.TestDocument `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations map[string]json.RawMessage `json:"aggregations"`
+}
+
+func (h *esHits) docs() []model.TestDocument {
+	docs := make([]model.TestDocument, len(h.Hits.Hits))
+	for i, hit := range h.Hits.Hits {
+		docs[i] = hit.Source
+	}
+	return docs
+}
+
+// search runs query against the index of the run. The hits must account
+// for every match, so the total and the documents agree.
+func (c *esChecker) search(ctx context.Context, query map[string]any) (*esHits, error) {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	size := 10
+	var hits esHits
+	req := esapi.SearchRequest{Index: []string{c.index}, Body: bytes.NewReader(body), Size: &size}
+	if err := c.getJSON(ctx, req, &hits); err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	if hits.Hits.Total.Value != len(hits.Hits.Hits) {
+		return nil, fmt.Errorf("search found %d documents but returned %d", hits.Hits.Total.Value, len(hits.Hits.Hits))
+	}
+	return &hits, nil
+}
+
+// compareDocs reports every document of want missing from got or differing
+// in it, and every document of got not in want.
+func compareDocs(got, want []model.TestDocument) error {
+	var errs []error
+	if len(got) != len(want) {
+		errs = append(errs, fmt.Errorf("found %d documents, want %d", len(got), len(want)))
+	}
+	for _, w := range want {
+		i := slices.IndexFunc(got, func(d model.TestDocument) bool { return d.ID == w.ID })
+		if i < 0 {
+			errs = append(errs, fmt.Errorf("document %s not found", w.ID))
+			continue
+		}
+		if g := got[i]; g.Name != w.Name || g.Value != w.Value || !g.Ts.Equal(w.Ts) {
+			errs = append(errs, fmt.Errorf("document %s is %+v, want %+v", w.ID, g, w))
+		}
+	}
+	for _, g := range got {
+		if !slices.ContainsFunc(want, func(d model.TestDocument) bool { return d.ID == g.ID }) {
+			errs = append(errs, fmt.Errorf("unexpected document %s", g.ID))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// filterDocs returns the inserted documents matching keep, which the
+// query being checked should find.
+func (c *esChecker) filterDocs(keep func(model.TestDocument) bool) []model.TestDocument {
+	var docs []model.TestDocument
+	for _, d := range c.docs {
+		if keep(d) {
+			docs = append(docs, d)
+		}
+	}
+	return docs
+}
+
+// query checks term, range and aggregation queries against what insert
+// indexed.
+func (c *esChecker) query(ctx context.Context) error {
+	if len(c.docs) == 0 {
+		return errors.New("no documents were inserted")
+	}
+	first, second := c.docs[0], c.docs[len(c.docs)/2]
+
+	checks := []struct {
+		name  string
+		query map[string]any
+		want  []model.TestDocument
+	}{
+		{
+			name:  fmt.Sprintf("term name.keyword = %q", first.Name),
+			query: map[string]any{"term": map[string]any{"name.keyword": first.Name}},
+			want:  c.filterDocs(func(d model.TestDocument) bool { return d.Name == first.Name }),
+		},
+		{
+			name:  "range 150 <= value <= 300",
+			query: map[string]any{"range": map[string]any{"value": map[string]any{"gte": 150, "lte": 300}}},
+			want:  c.filterDocs(func(d model.TestDocument) bool { return d.Value >= 150 && d.Value <= 300 }),
+		},
+		{
+			name:  "range timestamp >= " + second.Ts.Format(time.RFC3339Nano),
+			query: map[string]any{"range": map[string]any{"timestamp": map[string]any{"gte": second.Ts.Format(time.RFC3339Nano)}}},
+			want:  c.filterDocs(func(d model.TestDocument) bool { return !d.Ts.Before(second.Ts) }),
+		},
+	}
+	var errs []error
+	for _, check := range checks {
+		hits, err := c.search(ctx, map[string]any{"query": check.query})
+		if err == nil {
+			err = compareDocs(hits.docs(), check.want)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", check.name, err))
+			continue
+		}
+		printf(ctx, "✓ %s: matched %d of %d documents\n", check.name, len(check.want), len(c.docs))
+	}
+
+	if err := c.aggregations(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("aggregations: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// aggregations checks stats on value and the latest timestamp against the
+// inserted documents.
+func (c *esChecker) aggregations(ctx context.Context) error {
+	hits, err := c.search(ctx, map[string]any{
+		"query": map[string]any{"match_all": map[string]any{}},
+		"aggs": map[string]any{
+			"value":  map[string]any{"stats": map[string]any{"field": "value"}},
+			"latest": map[string]any{"max": map[string]any{"field": "timestamp"}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	var stats struct {
+		Count int     `json:"count"`
+		Min   float64 `json:"min"`
+		Max   float64 `json:"max"`
+		Sum   float64 `json:"sum"`
+	}
+	var latest struct {
+		Value float64 `json:"value"` // epoch milliseconds
+	}
+	if err := json.Unmarshal(hits.Aggregations["value"], &stats); err != nil {
+		return fmt.Errorf("decode stats: %w", err)
+	}
+	if err := json.Unmarshal(hits.Aggregations["latest"], &latest); err != nil {
+		return fmt.Errorf("decode max: %w", err)
+	}
+
+	want := struct {
+		count         int
+		min, max, sum float64
+		latest        time.Time
+	}{count: len(c.docs), min: float64(c.docs[0].Value), max: float64(c.docs[0].Value)}
+	for _, d := range c.docs {
+		want.min = min(want.min, float64(d.Value))
+		want.max = max(want.max, float64(d.Value))
+		want.sum += float64(d.Value)
+		if d.Ts.After(want.latest) {
+			want.latest = d.Ts
+		}
+	}
+
+	var diffs []string
+	if stats.Count != want.count {
+		diffs = append(diffs, fmt.Sprintf("count %d, want %d", stats.Count, want.count))
+	}
+	if stats.Min != want.min || stats.Max != want.max {
+		diffs = append(diffs, fmt.Sprintf("value range %g-%g, want %g-%g", stats.Min, stats.Max, want.min, want.max))
+	}
+	if stats.Sum != want.sum {
+		diffs = append(diffs, fmt.Sprintf("sum %g, want %g", stats.Sum, want.sum))
+	}
+	if got := time.UnixMilli(int64(latest.Value)); !got.Equal(want.latest) {
+		diffs = append(diffs, fmt.Sprintf("latest timestamp %s, want %s",
+			got.UTC().Format(time.RFC3339Nano), want.latest.Format(time.RFC3339Nano)))
+	}
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, "; "))
+	}
+	printf(ctx, "✓ Aggregations: count %d, value %g-%g, sum %g, latest %s\n",
+		stats.Count, stats.Min, stats.Max, stats.Sum, want.latest.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"data-check-all/model"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// baseKey is the stem of every key the key/value checkers write.
+const baseKey = "test_key"
+
+// keyspace namespaces test keys so they never collide with real data.
+type keyspace string
+
+func (p keyspace) add(key string) string {
+	return string(p) + key
+}
+
+func (p keyspace) trim(key string) string {
+	return strings.TrimPrefix(key, string(p))
+}
+
+// testRange returns the [start, end) range holding every test key of the
+// run, or of every run when runID is empty. Run IDs sort below "z".
+func (p keyspace) testRange(runID string) (start, end string) {
+	stem := baseKey + "_"
+	if runID != "" {
+		stem += runID + "_"
+	}
+	return p.add(stem), p.add(stem + "z")
+}
+
+// testKey is the nth test key of the run, e.g. test_key_<run ID>_1.
+func testKey(runID string, n int) string {
+	if runID == "" {
+		return baseKey + "_" + strconv.Itoa(n)
+	}
+	return baseKey + "_" + runID + "_" + strconv.Itoa(n)
+}
+
+// errNoItems fails the steps checking test keys when insert stored none,
+// rather than letting them pass on nothing.
+var errNoItems = errors.New("no test keys were inserted")
+
+// checkScanned fails a scan that found fewer keys than were inserted.
+func checkScanned(found int, items []model.TestKeyValue) error {
+	if found < len(items) {
+		return fmt.Errorf("scan found %d keys, want at least the %d inserted", found, len(items))
+	}
+	return nil
+}
+
+// newTestItems returns the three keys inserted, read, updated and deleted
+// by the TiKV, TiDB and ClickHouse checkers in the given run.
+func newTestItems(runID string) []model.TestKeyValue {
+	items := make([]model.TestKeyValue, 3)
+	for i := range items {
+		n := strconv.Itoa(i + 1)
+		items[i] = model.TestKeyValue{
+			Key:   testKey(runID, i+1),
+			Value: "Initial value for test key " + n,
+			Ts:    time.Now(),
+		}
+	}
+	return items
+}
+
+// keyRunID returns the run ID in a test key, or "" for a key written
+// before runs had IDs, e.g. test_key_1.
+func keyRunID(key string) string {
+	rest := strings.TrimPrefix(key, baseKey+"_")
+	i := strings.LastIndex(rest, "_")
+	if i < 0 {
+		return ""
+	}
+	return rest[:i]
+}
+
+// artifacts groups test keys, as stored, by the run that wrote them,
+// leaving out the runs that started at or after before.
+func (p keyspace) artifacts(kind string, keys []string, before time.Time) []Artifact {
+	var found []Artifact
+	index := make(map[string]int)
+	for _, key := range keys {
+		runID := keyRunID(p.trim(key))
+		if !sweepable(runID, before) {
+			continue
+		}
+		i, ok := index[runID]
+		if !ok {
+			name := p.add(baseKey + "_N")
+			if runID != "" {
+				name = p.add(baseKey + "_" + runID + "_*")
+			}
+			i = len(found)
+			index[runID] = i
+			found = append(found, Artifact{Kind: kind, Name: name, RunID: runID})
+		}
+		found[i].Keys = append(found[i].Keys, key)
+	}
+	return found
+}
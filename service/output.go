@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+type outputKey struct{}
+
+// withOutput makes printf and logf of everything running under ctx write
+// to w.
+func withOutput(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, outputKey{}, w)
+}
+
+func output(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(outputKey{}).(io.Writer); ok {
+		return w
+	}
+	return os.Stdout
+}
+
+// printf writes a progress line for the target running under ctx.
+func printf(ctx context.Context, format string, args ...any) {
+	fmt.Fprintf(output(ctx), format, args...)
+}
+
+// logf is printf with a timestamp, like the standard logger.
+func logf(ctx context.Context, format string, args ...any) {
+	log.New(output(ctx), "", log.LstdFlags).Printf(format, args...)
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"data-check-all/model"
+	"io"
+	"sync"
+)
+
+// forEach calls fn for every target, up to opts.Concurrency.Workers at a
+// time. With more than one worker the output of each target is buffered
+// and written in one piece once it finishes, so targets never interleave.
+//
+// fn is also called for targets that never got a worker because ctx was
+// cancelled first; it sees ctx.Err() and should record them as skipped.
+func (o Options) forEach(ctx context.Context, targets []Target, fn func(ctx context.Context, i int, t Target)) {
+	if o.Concurrency.Workers <= 1 {
+		for i, t := range targets {
+			fn(ctx, i, t)
+		}
+		return
+	}
+
+	lim := newLimits(o.Concurrency)
+	out := &serialOutput{w: output(ctx)}
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Go(func() {
+			if release, ok := lim.acquire(ctx, t.Backend); ok {
+				defer release()
+			}
+			out.run(ctx, func(ctx context.Context) { fn(ctx, i, t) })
+		})
+	}
+	wg.Wait()
+}
+
+// serialOutput writes the output of targets running at once to w, one
+// target at a time.
+type serialOutput struct {
+	mu sync.Mutex // guards w
+	w  io.Writer
+}
+
+// run calls fn with its output buffered, and writes it out in one piece
+// once fn returns.
+func (o *serialOutput) run(ctx context.Context, fn func(ctx context.Context)) {
+	var buf bytes.Buffer
+	fn(withOutput(ctx, &buf))
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.w.Write(buf.Bytes())
+}
+
+// limits holds the slots Concurrency allows: Workers in all, and the cap
+// of each backend on top.
+type limits struct {
+	all        chan struct{}
+	perBackend map[string]chan struct{}
+}
+
+func newLimits(c model.Concurrency) *limits {
+	l := &limits{
+		all:        make(chan struct{}, max(c.Workers, 1)),
+		perBackend: make(map[string]chan struct{}),
+	}
+	for b, n := range c.PerBackend {
+		l.perBackend[b] = make(chan struct{}, n)
+	}
+	return l
+}
+
+// acquire takes a slot for a target of backend, and returns the function
+// giving it back. It gives up when ctx is cancelled first.
+func (l *limits) acquire(ctx context.Context, backend string) (release func(), ok bool) {
+	sem, capped := l.perBackend[backend]
+	// The backend slot first, so a target waiting on its backend does not
+	// hold a worker others could use
+	if capped && !acquire(ctx, sem) {
+		return nil, false
+	}
+	if !acquire(ctx, l.all) {
+		if capped {
+			<-sem
+		}
+		return nil, false
+	}
+	return func() {
+		<-l.all
+		if capped {
+			<-sem
+		}
+	}, true
+}
+
+// acquire takes a slot of sem, giving up when ctx is cancelled.
+func acquire(ctx context.Context, sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
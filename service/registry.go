@@ -0,0 +1,253 @@
+package service
+
+import (
+	"data-check-all/model"
+	"errors"
+	"fmt"
+	"go.yaml.in/yaml/v4"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Target is one configured instance of a backend, ready to be checked.
+type Target struct {
+	Backend string // YAML section name, e.g. "tidb"
+	Name    string // e.g. "TiDB 2"
+	Config  any    // the decoded model config
+	Options model.TargetOptions
+	Checker Checker
+
+	newChecker func() Checker
+	node       *yaml.Node // the config entry, for errors
+}
+
+// Fresh returns a copy of t with a new, unconnected checker, so the same
+// target can be checked by several runs at once.
+func (t Target) Fresh() Target {
+	t.Checker = t.newChecker()
+	return t
+}
+
+type backend struct {
+	name  string
+	title string
+	load  func(node *yaml.Node) ([]Target, error)
+	steps func(entry *yaml.Node) []Step
+}
+
+var backends []backend
+
+// Register makes a backend available under the given YAML section name.
+// newChecker is called once per entry in that section. Backends register
+// themselves from init, so main never has to know about them.
+func Register[T any](name, title string, newChecker func(cfg T) Checker) {
+	for _, b := range backends {
+		if b.name == name {
+			panic("service: backend registered twice: " + name)
+		}
+	}
+	backends = append(backends, backend{
+		name:  name,
+		title: title,
+		load: func(node *yaml.Node) ([]Target, error) {
+			if node.Kind != yaml.SequenceNode {
+				return nil, ErrorAt(node, "%s must be a list of targets", name)
+			}
+			var targets []Target
+			var errs []error
+			for i, entry := range node.Content {
+				errs = append(errs, CheckKeys(entry, reflect.TypeFor[T]())...)
+				var cfg T
+				if err := entry.Decode(&cfg); err != nil {
+					errs = append(errs, DecodeErrors(err)...)
+					continue
+				}
+				errs = append(errs, checkFields(entry, cfg)...)
+
+				t := Target{
+					Backend:    name,
+					Name:       fmt.Sprintf("%s %d", title, i+1),
+					Config:     cfg,
+					Checker:    newChecker(cfg),
+					newChecker: func() Checker { return newChecker(cfg) },
+					node:       entry,
+				}
+				if o, ok := any(cfg).(interface{ Options() model.TargetOptions }); ok {
+					t.Options = o.Options()
+				}
+				if t.Options.Name != "" {
+					t.Name = t.Options.Name
+				}
+				targets = append(targets, t)
+			}
+			return targets, errors.Join(errs...)
+		},
+		steps: func(entry *yaml.Node) []Step {
+			// Fields that fail to decode stay zero; the rest still decide
+			// the steps
+			var cfg T
+			entry.Decode(&cfg)
+			return newChecker(cfg).Steps()
+		},
+	})
+}
+
+// Backends returns the registered section names in registration order.
+func Backends() []string {
+	names := make([]string, len(backends))
+	for i, b := range backends {
+		names[i] = b.name
+	}
+	return names
+}
+
+// StepNames returns the names of the steps of every target in root, the
+// whole config, even when some of its entries are invalid.
+func StepNames(root *yaml.Node) []string {
+	var names []string
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		b := slices.IndexFunc(backends, func(b backend) bool { return b.name == root.Content[i].Value })
+		section := root.Content[i+1]
+		if b < 0 || section.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, entry := range section.Content {
+			for _, s := range backends[b].steps(entry) {
+				if !slices.Contains(names, s.Name) {
+					names = append(names, s.Name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// Load builds the targets for every config section, in registration order.
+// It reports every problem found in the sections, not just the first.
+func Load(sections map[string]yaml.Node) ([]Target, error) {
+	for name := range sections {
+		if !registered(name) {
+			return nil, fmt.Errorf("unknown backend %q", name)
+		}
+	}
+
+	var targets []Target
+	var errs []error
+	for _, b := range backends {
+		node, ok := sections[b.name]
+		if !ok {
+			continue
+		}
+		ts, err := b.load(&node)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		targets = append(targets, ts...)
+	}
+
+	// Names select targets and label their results, so they must be unique
+	seen := make(map[string]bool)
+	for _, t := range targets {
+		if seen[t.Name] {
+			errs = append(errs, ErrorAt(t.node, "duplicate target name %q", t.Name))
+		}
+		seen[t.Name] = true
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// Filter picks targets. An empty field matches everything.
+type Filter struct {
+	Backends []string
+	Names    []string
+	// Labels must all be set on a target, with the same values.
+	Labels map[string]string
+}
+
+// ParseSelector parses a label selector such as "env=prod,region=eu".
+func ParseSelector(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid selector %q, want key=value", item)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// SplitList splits a comma-separated list such as "es,tidb", dropping
+// blanks.
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// errNoMatch fails a selection that matches no target.
+var errNoMatch = errors.New("no target matches the backend, target and selector filters")
+
+// Select keeps the targets matched by f.
+func Select(targets []Target, f Filter) ([]Target, error) {
+	for _, b := range f.Backends {
+		if !registered(b) {
+			return nil, fmt.Errorf("unknown backend %q", b)
+		}
+	}
+	for _, n := range f.Names {
+		if !slices.ContainsFunc(targets, func(t Target) bool { return t.Name == n }) {
+			return nil, fmt.Errorf("no target named %q", n)
+		}
+	}
+
+	var selected []Target
+	for _, t := range targets {
+		if len(f.Backends) > 0 && !slices.Contains(f.Backends, t.Backend) {
+			continue
+		}
+		if len(f.Names) > 0 && !slices.Contains(f.Names, t.Name) {
+			continue
+		}
+		if !t.matches(f.Labels) {
+			continue
+		}
+		selected = append(selected, t)
+	}
+	// A filter picking nothing is a mistake, such as a misspelt label or a
+	// backend with no targets, not a run that checks nothing and passes
+	if len(selected) == 0 && (len(f.Backends) > 0 || len(f.Names) > 0 || len(f.Labels) > 0) {
+		return nil, errNoMatch
+	}
+	return selected, nil
+}
+
+func (t Target) matches(labels map[string]string) bool {
+	for k, v := range labels {
+		if got, ok := t.Options.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+func registered(name string) bool {
+	for _, b := range backends {
+		if b.name == name {
+			return true
+		}
+	}
+	return false
+}
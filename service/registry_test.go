@@ -0,0 +1,68 @@
+package service
+
+import (
+	"data-check-all/model"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	labels := func(kv ...string) model.TargetOptions {
+		o := model.TargetOptions{Labels: make(map[string]string)}
+		for i := 0; i+1 < len(kv); i += 2 {
+			o.Labels[kv[i]] = kv[i+1]
+		}
+		return o
+	}
+	targets := []Target{
+		{Backend: "tidb", Name: "TiDB 1", Options: labels("env", "prod")},
+		{Backend: "tidb", Name: "TiDB 2", Options: labels("env", "dev")},
+		{Backend: "es", Name: "ES 1", Options: labels("env", "prod", "region", "eu")},
+	}
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		want    []string
+		wantErr error
+	}{
+		{name: "everything", want: []string{"TiDB 1", "TiDB 2", "ES 1"}},
+		{name: "backend", filter: Filter{Backends: []string{"es"}}, want: []string{"ES 1"}},
+		{name: "names", filter: Filter{Names: []string{"TiDB 2", "ES 1"}}, want: []string{"TiDB 2", "ES 1"}},
+		{name: "labels", filter: Filter{Labels: map[string]string{"env": "prod"}}, want: []string{"TiDB 1", "ES 1"}},
+		{
+			name:   "all filters at once",
+			filter: Filter{Backends: []string{"tidb"}, Labels: map[string]string{"env": "prod"}},
+			want:   []string{"TiDB 1"},
+		},
+		{name: "backend without targets", filter: Filter{Backends: []string{"tikv"}}, wantErr: errNoMatch},
+		{
+			name:    "backend and name that do not meet",
+			filter:  Filter{Backends: []string{"es"}, Names: []string{"TiDB 1"}},
+			wantErr: errNoMatch,
+		},
+		{name: "label nobody has", filter: Filter{Labels: map[string]string{"env": "prd"}}, wantErr: errNoMatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Select(targets, tt.filter)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, t := range got {
+				names = append(names, t.Name)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("selected %q, want %q", names, tt.want)
+			}
+		})
+	}
+
+	for _, f := range []Filter{{Backends: []string{"mongo"}}, {Names: []string{"TiDB 3"}}} {
+		if _, err := Select(targets, f); err == nil || errors.Is(err, errNoMatch) {
+			t.Errorf("Select(%+v) = %v, want it to name the unknown backend or target", f, err)
+		}
+	}
+}
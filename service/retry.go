@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// Classifier is implemented by checkers that know which errors of their
+// driver are transient, so the step is worth trying again, and which are
+// permanent, such as a wrong password.
+type Classifier interface {
+	Transient(err error) bool
+}
+
+// transient is the classification every driver shares: network failures
+// and timed out attempts are transient, anything else permanent.
+func transient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
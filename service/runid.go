@@ -0,0 +1,43 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// runIDTime is the layout of the start time leading every run ID.
+const runIDTime = "20060102t150405"
+
+// NewRunID returns a unique, sortable ID for a run, e.g.
+// "20261017t120501-3f9a0c1e". It is lower case so it can be used in
+// Elasticsearch index names.
+func NewRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().UTC().Format(runIDTime) + "-" + hex.EncodeToString(b)
+}
+
+// RunTime returns the time the run with the given ID started, or false if
+// the ID was not made by NewRunID.
+func RunTime(id string) (time.Time, bool) {
+	stamp, _, ok := strings.Cut(id, "-")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(runIDTime, stamp)
+	return t, err == nil
+}
+
+// sweepable reports whether the data of a run is old enough to sweep: the
+// run started before the given time, which is zero to sweep everything.
+// Data of an unknown run, such as data written before runs had IDs, is
+// always old enough.
+func sweepable(runID string, before time.Time) bool {
+	if before.IsZero() {
+		return true
+	}
+	t, ok := RunTime(runID)
+	return !ok || t.Before(before)
+}
@@ -0,0 +1,478 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"data-check-all/model"
+	"data-check-all/redact"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Options controls how targets are run.
+type Options struct {
+	Policy      model.Policy
+	Concurrency model.Concurrency
+	// Timeouts and Retry apply to every target that does not set its own.
+	Timeouts model.Timeouts
+	Retry    model.Retry
+	// Steps restricts the run to the named steps, plus any required setup
+	// steps they depend on. Empty means every step.
+	Steps []string
+	// Progress receives the step-by-step output. Defaults to stdout.
+	Progress io.Writer
+	// RunID identifies the run in reports. Generated when empty.
+	RunID string
+}
+
+func (o Options) newReport() model.Report {
+	id := o.RunID
+	if id == "" {
+		id = NewRunID()
+	}
+	return model.Report{RunID: id, Started: time.Now()}
+}
+
+func (o Options) context(ctx context.Context) context.Context {
+	if o.Progress != nil {
+		return withOutput(ctx, o.Progress)
+	}
+	return ctx
+}
+
+// Validate checks that every requested step exists on at least one target.
+func (o Options) Validate(targets []Target) error {
+	for _, name := range o.Steps {
+		found := false
+		for _, t := range targets {
+			for _, s := range t.Checker.Steps() {
+				found = found || s.Name == name
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown step %q", name)
+		}
+	}
+	return nil
+}
+
+func (o Options) selected(step string) bool {
+	if len(o.Steps) == 0 {
+		return true
+	}
+	for _, s := range o.Steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// steps returns the steps of c that this run executes: the required ones,
+// the selected ones and every step they need.
+func (o Options) steps(c Checker) []Step {
+	all := c.Steps()
+	include := make(map[string]bool)
+	var add func(name string)
+	add = func(name string) {
+		if include[name] {
+			return
+		}
+		include[name] = true
+		for _, s := range all {
+			if s.Name == name {
+				for _, need := range s.Needs {
+					add(need)
+				}
+			}
+		}
+	}
+	for _, s := range all {
+		if s.Required || o.selected(s.Name) {
+			add(s.Name)
+		}
+	}
+
+	var steps []Step
+	for _, s := range all {
+		if include[s.Name] {
+			steps = append(steps, s)
+		}
+	}
+	return steps
+}
+
+// Run checks every target, several at once if opts.Concurrency allows, and
+// returns what happened in config order. Targets that are not started,
+// because ctx was cancelled or a target failed under a fail-fast policy,
+// are reported as skipped.
+func Run(ctx context.Context, targets []Target, opts Options) model.Report {
+	ctx = opts.context(ctx)
+	report := opts.newReport()
+	opts.RunID = report.RunID
+	report.Targets = make([]model.TargetResult, len(targets))
+	var stop atomic.Bool
+	opts.forEach(ctx, targets, func(ctx context.Context, i int, t Target) {
+		if ctx.Err() != nil || stop.Load() {
+			report.Targets[i] = skipTarget(t, opts)
+			return
+		}
+		res := runTarget(ctx, t, opts)
+		report.Targets[i] = res
+		if res.Failed() && opts.Policy.FailFast() && !stop.Swap(true) {
+			logf(ctx, "Stopping after %s failed (fail-fast)", t.Name)
+		}
+	})
+	report.Interrupted = ctx.Err() != nil
+	report.Duration = time.Since(report.Started)
+	return report
+}
+
+// targetRun collects the step results of one target as they happen.
+type targetRun struct {
+	opts      Options
+	result    model.TargetResult
+	secrets   []string // masked in errors and output
+	timeouts  model.Timeouts
+	retry     model.Retry
+	transient func(error) bool
+}
+
+func newTargetRun(t Target, opts Options) *targetRun {
+	classify := transient
+	if c, ok := t.Checker.(Classifier); ok {
+		classify = c.Transient
+	}
+	return &targetRun{
+		opts:      opts,
+		secrets:   redact.Secrets(t.Config),
+		timeouts:  opts.Timeouts.Override(t.Options.Timeouts),
+		retry:     opts.Retry.Override(t.Options.Retry),
+		transient: classify,
+		result: model.TargetResult{
+			Target:  t.Name,
+			Backend: t.Backend,
+			Labels:  t.Options.Labels,
+			Addr:    t.Checker.Addr(),
+		},
+	}
+}
+
+// deadline bounds everything the target does under ctx by its timeout.
+func (r *targetRun) deadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, r.timeouts.Target)
+}
+
+// redacted makes the output under ctx mask the secrets of the target.
+func (r *targetRun) redacted(ctx context.Context) context.Context {
+	return withOutput(ctx, redact.Writer(output(ctx), r.secrets...))
+}
+
+func (r *targetRun) record(step string, status model.StepStatus, d time.Duration, err error) {
+	r.result.Steps = append(r.result.Steps, r.stepResult(step, status, d, err))
+}
+
+func (r *targetRun) stepResult(step string, status model.StepStatus, d time.Duration, err error) model.StepResult {
+	sr := model.StepResult{
+		Target:        r.result.Target,
+		Backend:       r.result.Backend,
+		Step:          step,
+		Status:        status,
+		Duration:      d,
+		ServerVersion: r.result.ServerVersion,
+	}
+	if err != nil {
+		sr.Error = redact.String(err.Error(), r.secrets...)
+	}
+	return sr
+}
+
+// exec runs fn as step under the connect or step timeout and records the
+// result.
+func (r *targetRun) exec(ctx context.Context, step string, fn func(context.Context) error) model.StepStatus {
+	timeout := r.timeouts.Step
+	if step == "connect" {
+		timeout = r.timeouts.Connect
+	}
+	sr := r.try(ctx, step, timeout, fn)
+	r.result.Steps = append(r.result.Steps, sr)
+	return sr.Status
+}
+
+// try runs fn as step, trying again after a transient error as the retry
+// policy allows, each attempt under timeout. A step whose last attempt ran
+// out of time is timed out, and a failure of a step the policy marks
+// non-fatal is a warning.
+func (r *targetRun) try(ctx context.Context, step string, timeout time.Duration, fn func(context.Context) error) model.StepResult {
+	start := time.Now()
+	var err error
+	var timedOut bool
+	attempts := 0
+	for {
+		attempts++
+		stepCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = fn(stepCtx)
+		timedOut = err != nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		retry := timedOut || r.transient(err) && !errors.Is(err, ErrAuth)
+		if err == nil || attempts >= r.retry.Attempts || ctx.Err() != nil || !retry {
+			break
+		}
+		wait := r.retry.Wait(attempts) + randDuration(r.retry.Jitter)
+		logf(ctx, "↻ %s attempt %d of %d failed, retrying in %s: %v", step, attempts, r.retry.Attempts, wait.Round(time.Millisecond), err)
+		if sleep(ctx, wait) != nil {
+			break
+		}
+	}
+
+	status := model.StatusPass
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrAuth):
+		status = model.StatusAuth
+	case timedOut:
+		status = model.StatusTimeout
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("target timed out after %s: %w", r.timeouts.Target, err)
+		} else {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+	default:
+		status = model.StatusFail
+	}
+	if err != nil && r.opts.Policy.NonFatal(step) {
+		status = model.StatusWarn
+	}
+	sr := r.stepResult(step, status, time.Since(start), err)
+	sr.Attempts = attempts
+	return sr
+}
+
+// connected stores the server version once the checker is connected. A
+// reused connection records no connect step.
+func (r *targetRun) connected(version string) {
+	r.result.ServerVersion = version
+	if n := len(r.result.Steps); n > 0 {
+		r.result.Steps[n-1].ServerVersion = version
+	}
+}
+
+// lastError is the error recorded by the most recent step.
+func (r *targetRun) lastError() string {
+	return r.result.Steps[len(r.result.Steps)-1].Error
+}
+
+// skip records every given step as skipped.
+func (r *targetRun) skip(steps []Step) {
+	for _, s := range steps {
+		r.record(s.Name, model.StatusSkip, 0, nil)
+	}
+}
+
+func skipTarget(t Target, opts Options) model.TargetResult {
+	run := newTargetRun(t, opts)
+	run.record("connect", model.StatusSkip, 0, nil)
+	run.skip(opts.steps(t.Checker))
+	return run.result
+}
+
+func runTarget(ctx context.Context, t Target, opts Options) model.TargetResult {
+	s := &session{target: t}
+	defer s.close()
+	return s.run(ctx, opts)
+}
+
+// session is a target whose checker may stay connected between runs.
+type session struct {
+	target    Target
+	connected bool
+}
+
+// run checks the target once, connecting first unless the previous run
+// left the checker connected. Whatever the steps created is torn down
+// before it returns, however they ended. A failed run drops the
+// connection, so the next one starts from scratch.
+func (s *session) run(ctx context.Context, opts Options) (result model.TargetResult) {
+	t := s.target
+	start := time.Now()
+	run := newTargetRun(t, opts)
+	ctx = run.redacted(ctx)
+	ctx, cancel := run.deadline(ctx)
+	defer cancel()
+	defer func() { result.Duration = time.Since(start) }()
+	defer func() {
+		if result.Failed() {
+			s.close()
+		}
+	}()
+
+	printf(ctx, "\n=== Testing %s: %s (run %s) ===\n", t.Name, run.result.Addr, opts.RunID)
+
+	steps := opts.steps(t.Checker)
+	if !s.connected {
+		if run.exec(ctx, "connect", t.Checker.Connect) != model.StatusPass {
+			logf(ctx, "❌ Failed to connect: %s", run.lastError())
+			run.skip(steps)
+			return run.result
+		}
+		s.connected = true
+	}
+	run.connected(t.Checker.Version())
+	t.Checker.SetRunID(opts.RunID)
+
+	ctx, td := withTeardown(ctx)
+	defer func() { // a no-op unless a step cut the run short
+		td.run(ctx, run)
+		result.Teardown = run.result.Teardown
+	}()
+
+	for i, step := range steps {
+		printf(ctx, "%d. %s...\n", i+1, step.Title)
+		status := run.exec(ctx, step.Name, step.Run)
+		switch status {
+		case model.StatusWarn:
+			logf(ctx, "⚠️ %s failed: %s", step.Title, run.lastError())
+		case model.StatusFail:
+			logf(ctx, "❌ %s failed: %s", step.Title, run.lastError())
+		case model.StatusTimeout:
+			logf(ctx, "❌ %s timed out: %s", step.Title, run.lastError())
+		case model.StatusAuth:
+			logf(ctx, "❌ %s was not authorized: %s", step.Title, run.lastError())
+		}
+		if (status != model.StatusPass && step.Required) || ctx.Err() != nil {
+			run.skip(steps[i+1:])
+			return run.result
+		}
+	}
+
+	td.run(ctx, run)
+	printf(ctx, "✅ %s test completed\n", t.Name)
+	return run.result
+}
+
+func (s *session) close() {
+	if s.connected {
+		s.target.Checker.Close()
+		s.connected = false
+	}
+}
+
+// Sweep selects the test data removed by Cleanup.
+type Sweep struct {
+	// OlderThan limits the sweep to data of runs that started at least
+	// this long ago. When zero, it is the longest a run of the target may
+	// take, teardown included, so runs in progress are left alone.
+	OlderThan time.Duration
+	// All sweeps the data of every run, even of runs in progress, and the
+	// tables shared by runs.
+	All bool
+	// DryRun lists the data without removing it.
+	DryRun bool
+}
+
+// before returns the time runs must have started before to be swept, given
+// when the sweep started and the longest a run may take. It is zero to
+// sweep every run.
+func (s Sweep) before(started time.Time, longest time.Duration) time.Time {
+	if s.All {
+		return time.Time{}
+	}
+	return started.Add(-cmp.Or(s.OlderThan, longest))
+}
+
+// Cleanup connects to every target, finds the test data left behind by
+// earlier runs and removes it.
+func Cleanup(ctx context.Context, targets []Target, opts Options, sweep Sweep) model.Report {
+	ctx = opts.context(ctx)
+	report := opts.newReport()
+	report.Targets = make([]model.TargetResult, len(targets))
+	opts.forEach(ctx, targets, func(ctx context.Context, i int, t Target) {
+		if ctx.Err() != nil {
+			run := newTargetRun(t, opts)
+			run.record("connect", model.StatusSkip, 0, nil)
+			run.record("discover", model.StatusSkip, 0, nil)
+			run.record("cleanup", model.StatusSkip, 0, nil)
+			report.Targets[i] = run.result
+			return
+		}
+		report.Targets[i] = cleanupTarget(ctx, t, opts, report.Started, sweep)
+	})
+	report.Interrupted = ctx.Err() != nil
+	report.Duration = time.Since(report.Started)
+	return report
+}
+
+func cleanupTarget(ctx context.Context, t Target, opts Options, started time.Time, sweep Sweep) (result model.TargetResult) {
+	start := time.Now()
+	run := newTargetRun(t, opts)
+	before := sweep.before(started, run.timeouts.Target+run.timeouts.Step)
+	ctx = run.redacted(ctx)
+	ctx, cancel := run.deadline(ctx)
+	defer cancel()
+	defer func() { result.Duration = time.Since(start) }()
+
+	printf(ctx, "\n=== Cleaning up %s: %s ===\n", t.Name, run.result.Addr)
+	if before.IsZero() {
+		printf(ctx, "Sweeping every run, including runs in progress\n")
+	} else {
+		printf(ctx, "Sweeping runs started before %s\n", before.Local().Format(time.DateTime))
+	}
+	if run.exec(ctx, "connect", t.Checker.Connect) != model.StatusPass {
+		logf(ctx, "❌ Failed to connect: %s", run.lastError())
+		run.record("discover", model.StatusSkip, 0, nil)
+		run.record("cleanup", model.StatusSkip, 0, nil)
+		return run.result
+	}
+	defer t.Checker.Close()
+	run.connected(t.Checker.Version())
+
+	var artifacts []Artifact
+	discover := func(ctx context.Context) (err error) {
+		artifacts, err = t.Checker.Artifacts(ctx, before)
+		if err != nil {
+			return err
+		}
+		printf(ctx, "✓ Found %d artifacts\n", len(artifacts))
+		for _, a := range artifacts {
+			printf(ctx, "  - %s (%s)\n", a, runAge(a.RunID))
+		}
+		return nil
+	}
+	if run.exec(ctx, "discover", discover) != model.StatusPass {
+		logf(ctx, "❌ Discovery failed: %s", run.lastError())
+		run.record("cleanup", model.StatusSkip, 0, nil)
+		return run.result
+	}
+	if sweep.DryRun {
+		run.record("cleanup", model.StatusSkip, 0, nil)
+		return run.result
+	}
+
+	remove := func(ctx context.Context) error {
+		var errs []error
+		for _, a := range artifacts {
+			if err := t.Checker.Remove(ctx, a); err != nil {
+				errs = append(errs, fmt.Errorf("remove %s: %w", a, err))
+				continue
+			}
+			printf(ctx, "✓ Removed %s\n", a)
+		}
+		return errors.Join(errs...)
+	}
+	if run.exec(ctx, "cleanup", remove) != model.StatusPass {
+		logf(ctx, "❌ Cleanup failed: %s", run.lastError())
+	}
+	return run.result
+}
+
+// runAge describes when the run with the given ID started.
+func runAge(runID string) string {
+	t, ok := RunTime(runID)
+	if !ok {
+		return "unknown run"
+	}
+	return fmt.Sprintf("run %s, %s ago", runID, time.Since(t).Truncate(time.Minute))
+}
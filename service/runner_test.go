@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"data-check-all/model"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeChecker runs the given steps against nothing.
+type fakeChecker struct {
+	steps      []Step
+	connectErr error
+}
+
+func (c *fakeChecker) Addr() string                      { return "fake:1" }
+func (c *fakeChecker) Connect(ctx context.Context) error { return c.connectErr }
+func (c *fakeChecker) Version() string                   { return "1.0" }
+func (c *fakeChecker) Steps() []Step                     { return c.steps }
+func (c *fakeChecker) SetRunID(id string)                {}
+func (c *fakeChecker) Close() error                      { return nil }
+
+func (c *fakeChecker) Artifacts(ctx context.Context, before time.Time) ([]Artifact, error) {
+	return nil, nil
+}
+
+func (c *fakeChecker) Remove(ctx context.Context, a Artifact) error { return nil }
+
+func fakeTarget(c *fakeChecker) Target {
+	return Target{Backend: "fake", Name: "Fake 1", Checker: c}
+}
+
+// quiet returns a context whose progress output is dropped.
+func quiet() context.Context {
+	return withOutput(context.Background(), io.Discard)
+}
+
+func TestTry(t *testing.T) {
+	errPermanent := errors.New("syntax error")
+	errTransient := fmt.Errorf("query: %w", io.ErrUnexpectedEOF)
+	errAuth := fmt.Errorf("login: %w", ErrAuth)
+
+	tests := []struct {
+		name     string
+		errs     []error // returned by each attempt, then nil
+		hang     bool    // every attempt runs out of time
+		nonFatal bool
+		want     model.StepStatus
+		attempts int
+	}{
+		{name: "pass", want: model.StatusPass, attempts: 1},
+		{name: "permanent", errs: []error{errPermanent}, want: model.StatusFail, attempts: 1},
+		{name: "transient then pass", errs: []error{errTransient, errTransient}, want: model.StatusPass, attempts: 3},
+		{name: "transient every time", errs: []error{errTransient, errTransient, errTransient}, want: model.StatusFail, attempts: 3},
+		{name: "auth is not retried", errs: []error{errAuth}, want: model.StatusAuth, attempts: 1},
+		{name: "timeout retried", hang: true, want: model.StatusTimeout, attempts: 3},
+		{name: "non-fatal failure warns", errs: []error{errPermanent}, nonFatal: true, want: model.StatusWarn, attempts: 1},
+		{name: "non-fatal timeout warns", hang: true, nonFatal: true, want: model.StatusWarn, attempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{
+				Timeouts: model.Timeouts{Step: 10 * time.Millisecond},
+				Retry:    model.Retry{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond},
+			}
+			if tt.nonFatal {
+				opts.Policy.NonFatalSteps = []string{"insert"}
+			}
+			run := newTargetRun(fakeTarget(&fakeChecker{}), opts)
+
+			calls := 0
+			fn := func(ctx context.Context) error {
+				calls++
+				if tt.hang {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			}
+			sr := run.try(quiet(), "insert", run.timeouts.Step, fn)
+			if sr.Status != tt.want || sr.Attempts != tt.attempts || calls != tt.attempts {
+				t.Errorf("status %s after %d attempts (%d calls), want %s after %d: %s",
+					sr.Status, sr.Attempts, calls, tt.want, tt.attempts, sr.Error)
+			}
+			if tt.hang && !strings.Contains(sr.Error, "timed out after 10ms") {
+				t.Errorf("error %q does not say the step timed out", sr.Error)
+			}
+		})
+	}
+}
+
+func TestTryStopsWhenCancelled(t *testing.T) {
+	run := newTargetRun(fakeTarget(&fakeChecker{}), Options{
+		Retry: model.Retry{Attempts: 5, Backoff: time.Hour, MaxBackoff: time.Hour},
+	})
+	ctx, cancel := context.WithCancel(quiet())
+	calls := 0
+	sr := run.try(ctx, "insert", time.Second, func(context.Context) error {
+		calls++
+		cancel()
+		return io.ErrUnexpectedEOF
+	})
+	if calls != 1 || sr.Status != model.StatusFail {
+		t.Errorf("status %s after %d calls, want fail after 1", sr.Status, calls)
+	}
+}
+
+// stepNames returns the names of steps.
+func stepNames(steps []Step) []string {
+	var names []string
+	for _, s := range steps {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// testSteps are shaped like those of the backends: required setup, an
+// insert the later steps check, and steps needing nothing.
+func testSteps(run func(name string) func(context.Context) error) []Step {
+	step := func(name string, required bool, needs ...string) Step {
+		return Step{Name: name, Title: name, Run: run(name), Required: required, Needs: needs}
+	}
+	return []Step{
+		step("create", true),
+		step("insert", false),
+		step("read", false, "insert"),
+		step("update", false, "insert", "read"),
+		step("health", false),
+	}
+}
+
+func TestSteps(t *testing.T) {
+	c := &fakeChecker{steps: testSteps(func(string) func(context.Context) error { return nil })}
+	tests := []struct {
+		name     string
+		selected []string
+		want     []string
+	}{
+		{"every step", nil, []string{"create", "insert", "read", "update", "health"}},
+		{"needs added", []string{"read"}, []string{"create", "insert", "read"}},
+		{"needs of needs added", []string{"update"}, []string{"create", "insert", "read", "update"}},
+		{"config order kept", []string{"health", "read"}, []string{"create", "insert", "read", "health"}},
+		{"needing nothing", []string{"health"}, []string{"create", "health"}},
+		{"required only", []string{"create"}, []string{"create"}},
+		{"unknown left out", []string{"nope"}, []string{"create"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stepNames(Options{Steps: tt.selected}.steps(c))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("steps = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionRun(t *testing.T) {
+	errStep := errors.New("step failed")
+	tests := []struct {
+		name       string
+		fail       string // the step that fails
+		connectErr error
+		selected   []string
+		want       map[string]model.StepStatus
+		teardown   bool // the teardown registered by create runs
+	}{
+		{
+			name: "every step passes",
+			want: map[string]model.StepStatus{
+				"connect": model.StatusPass, "create": model.StatusPass, "insert": model.StatusPass,
+				"read": model.StatusPass, "update": model.StatusPass, "health": model.StatusPass,
+			},
+			teardown: true,
+		},
+		{
+			name: "required failure skips the rest",
+			fail: "create",
+			want: map[string]model.StepStatus{
+				"connect": model.StatusPass, "create": model.StatusFail, "insert": model.StatusSkip,
+				"read": model.StatusSkip, "update": model.StatusSkip, "health": model.StatusSkip,
+			},
+			teardown: true,
+		},
+		{
+			name: "other failures do not",
+			fail: "insert",
+			want: map[string]model.StepStatus{
+				"connect": model.StatusPass, "create": model.StatusPass, "insert": model.StatusFail,
+				"read": model.StatusPass, "update": model.StatusPass, "health": model.StatusPass,
+			},
+			teardown: true,
+		},
+		{
+			name:     "selected steps and their needs",
+			selected: []string{"read"},
+			want: map[string]model.StepStatus{
+				"connect": model.StatusPass, "create": model.StatusPass, "insert": model.StatusPass,
+				"read": model.StatusPass,
+			},
+			teardown: true,
+		},
+		{
+			name:       "failed connect skips every step",
+			connectErr: errStep,
+			want: map[string]model.StepStatus{
+				"connect": model.StatusFail, "create": model.StatusSkip, "insert": model.StatusSkip,
+				"read": model.StatusSkip, "update": model.StatusSkip, "health": model.StatusSkip,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran []string
+			tornDown := false
+			c := &fakeChecker{connectErr: tt.connectErr}
+			c.steps = testSteps(func(name string) func(context.Context) error {
+				return func(ctx context.Context) error {
+					ran = append(ran, name)
+					if name == "create" {
+						onTeardown(ctx, "drop", func(context.Context) error {
+							tornDown = true
+							return nil
+						})
+					}
+					if name == tt.fail {
+						return errStep
+					}
+					return nil
+				}
+			})
+
+			s := &session{target: fakeTarget(c)}
+			res := s.run(quiet(), Options{Steps: tt.selected})
+			got := make(map[string]model.StepStatus)
+			for _, sr := range res.Steps {
+				got[sr.Step] = sr.Status
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("steps = %v, want %v", got, tt.want)
+			}
+			for _, name := range ran {
+				if got[name] == model.StatusSkip {
+					t.Errorf("skipped step %s ran", name)
+				}
+			}
+			if tornDown != tt.teardown || (len(res.Teardown) == 1) != tt.teardown {
+				t.Errorf("teardown ran: %v, recorded %v, want it to run: %v", tornDown, res.Teardown, tt.teardown)
+			}
+			if wantConnected := !res.Failed(); s.connected != wantConnected {
+				t.Errorf("connected = %v after the run, want %v", s.connected, wantConnected)
+			}
+		})
+	}
+}
+
+func TestSessionRunTimeoutTearsDown(t *testing.T) {
+	tornDown := false
+	c := &fakeChecker{steps: []Step{
+		{Name: "create", Title: "create", Required: true, Run: func(ctx context.Context) error {
+			onTeardown(ctx, "drop", func(ctx context.Context) error {
+				tornDown = ctx.Err() == nil // teardown outlives the target deadline
+				return nil
+			})
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		{Name: "read", Title: "read", Run: func(context.Context) error { return nil }},
+	}}
+	s := &session{target: fakeTarget(c)}
+	res := s.run(quiet(), Options{Timeouts: model.Timeouts{Step: 10 * time.Millisecond}})
+	if res.Steps[1].Status != model.StatusTimeout || res.Steps[2].Status != model.StatusSkip {
+		t.Errorf("steps = %+v, want create timed out and read skipped", res.Steps)
+	}
+	if !tornDown {
+		t.Error("teardown did not run after the timeout")
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"data-check-all/model"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Schedule checks every target over and over, each on its own interval,
+// until ctx is cancelled. A target never starts a run before its previous
+// one has finished, and keeps its connection between runs that pass. Runs
+// due at the same time wait for a slot as opts.Concurrency allows, as in
+// Run. The output of each run is written in one piece once it finishes, so
+// runs never interleave. done receives the report of every run, one target
+// per report.
+func Schedule(ctx context.Context, targets []Target, opts Options, sched model.Schedule, done func(model.Report)) {
+	ctx = opts.context(ctx)
+	lim := newLimits(opts.Concurrency)
+	out := &serialOutput{w: output(ctx)}
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Go(func() {
+			scheduleTarget(ctx, t, opts, lim, out, sched.IntervalFor(t.Options), sched.Jitter, done)
+		})
+	}
+	wg.Wait()
+}
+
+func scheduleTarget(ctx context.Context, t Target, opts Options, lim *limits, out *serialOutput, interval, jitter time.Duration, done func(model.Report)) {
+	s := &session{target: t}
+	defer s.close()
+
+	out.run(ctx, func(ctx context.Context) { logf(ctx, "Checking %s every %s", t.Name, interval) })
+	// Spread the first runs out too, so targets do not all start at once
+	next := time.Now().Add(randDuration(jitter))
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		release, ok := lim.acquire(ctx, t.Backend)
+		if !ok {
+			return
+		}
+
+		report := opts.newReport()
+		runOpts := opts
+		runOpts.RunID = report.RunID
+		out.run(ctx, func(ctx context.Context) {
+			report.Targets = []model.TargetResult{s.run(ctx, runOpts)}
+		})
+		report.Duration = time.Since(report.Started)
+		report.Interrupted = ctx.Err() != nil
+		release()
+		done(report)
+
+		// Intervals are measured start to start; a run that overran its
+		// interval is followed by the next one right away, never overlapped.
+		next = report.Started.Add(interval + randDuration(jitter))
+	}
+}
+
+// randDuration returns a random duration in [0, max).
+func randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"data-check-all/model"
+	"slices"
+)
+
+// teardown holds the actions undoing what the steps of one target run
+// created, such as deleting its index. They run once the target is done,
+// whether its steps passed, failed, timed out or were interrupted.
+type teardown struct {
+	actions []teardownAction
+}
+
+type teardownAction struct {
+	name string // like a step name, e.g. "delete_index"
+	run  func(ctx context.Context) error
+}
+
+type teardownKey struct{}
+
+// withTeardown makes onTeardown of every step running under ctx register
+// with the returned teardown.
+func withTeardown(ctx context.Context) (context.Context, *teardown) {
+	td := &teardown{}
+	return context.WithValue(ctx, teardownKey{}, td), td
+}
+
+// onTeardown registers fn to undo a resource the calling step is about to
+// create. Registering before creating means a request that timed out after
+// the server acted is still undone, so fn must accept that the resource
+// may not exist. A name registered again, as by a retried step, is kept
+// once.
+func onTeardown(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	td, ok := ctx.Value(teardownKey{}).(*teardown)
+	if !ok || slices.ContainsFunc(td.actions, func(a teardownAction) bool { return a.name == name }) {
+		return
+	}
+	td.actions = append(td.actions, teardownAction{name: name, run: fn})
+}
+
+// run runs the actions newest first, recording each in the teardown
+// results of r. Cancelling ctx does not stop them: each is bounded by the
+// step timeout alone.
+func (td *teardown) run(ctx context.Context, r *targetRun) {
+	if len(td.actions) == 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	printf(ctx, "Tearing down...\n")
+	for _, a := range slices.Backward(td.actions) {
+		sr := r.try(ctx, a.name, r.timeouts.Step, a.run)
+		r.result.Teardown = append(r.result.Teardown, sr)
+		if sr.Status != model.StatusPass {
+			logf(ctx, "⚠️ Teardown %s failed: %s", a.name, sr.Error)
+		}
+	}
+	td.actions = nil
+}
@@ -6,313 +6,330 @@ import (
 	"crypto/x509"
 	"data-check-all/model"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"github.com/go-sql-driver/mysql"
-	_ "github.com/go-sql-driver/mysql"
-	"log"
-	"os"
+	"slices"
 	"strings"
 	"time"
 )
 
-func TestTiDB(tidbs []model.TiDBConfig) {
-	ctx := context.Background()
-	prefix := "devops" + ":"
+func init() {
+	Register("tidb", "TiDB", newTiDBChecker)
+}
 
-	addPrefix := func(key string) string {
-		return prefix + key
-	}
+type tidbChecker struct {
+	cfg     model.TiDBConfig
+	keys    keyspace
+	runID   string
+	table   string // database-qualified table
+	db      *sql.DB
+	version string
+	items   []model.TestKeyValue // keys inserted successfully
+}
 
-	removePrefix := func(key string) string {
-		return strings.TrimPrefix(key, prefix)
+func newTiDBChecker(cfg model.TiDBConfig) Checker {
+	tableName := cfg.TableName
+	if tableName == "" {
+		tableName = "test"
 	}
+	return &tidbChecker{
+		cfg:   cfg,
+		keys:  keyspace(cfg.Database + ":"),
+		table: fmt.Sprintf("`%s`.`%s`", cfg.Database, tableName),
+	}
+}
 
-	loadCertFromFile := func(filePath string) ([]byte, error) {
-		if filePath == "" {
-			return nil, nil // Empty path means no cert
-		}
-		data, err := os.ReadFile(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read cert file %s: %w", filePath, err)
-		}
-		return data, nil
+func (c *tidbChecker) Addr() string {
+	return fmt.Sprintf("%s:%d", c.cfg.Host, c.cfg.Port)
+}
+
+// registerTLS registers the TLS config for this target with the MySQL
+// driver and returns the name to reference it by in the DSN.
+func (c *tidbChecker) registerTLS(ctx context.Context) (string, error) {
+	logf(ctx, "TLS enabled for TiDB connection")
+
+	if c.cfg.SSLCACRT == "" {
+		// For no CA, register insecure config
+		tlsConfigName := "tidb-insecure"
+		mysql.RegisterTLSConfig(tlsConfigName, &tls.Config{InsecureSkipVerify: true})
+		return tlsConfigName, nil
+	}
+	caPEM, err := loadCertFromFile(c.cfg.SSLCACRT)
+	if err != nil {
+		return "", fmt.Errorf("failed to load CA cert: %w", err)
 	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(caPEM)
 
-	getTLSConfig := func(config model.TiDBConfig) string {
-		if !config.TLS {
-			return "" // No TLS, return empty
-		}
-		log.Println("TLS enabled for TiDB connection")
+	tlsConfig := &tls.Config{
+		RootCAs:            caCertPool,
+		InsecureSkipVerify: true,
+	}
 
-		// Load CA cert
-		caPEM, err := loadCertFromFile(config.SSLCACRT)
+	// Load client cert and key if provided
+	if c.cfg.SSLClientCRT != "" && c.cfg.SSLClientKey != "" {
+		certPEM, err := loadCertFromFile(c.cfg.SSLClientCRT)
 		if err != nil {
-			log.Fatalf("Failed to load CA cert: %v", err)
-		}
-		if caPEM == nil {
-			// For no CA, register insecure config
-			tlsConfigName := "tidb-insecure"
-			mysql.RegisterTLSConfig(tlsConfigName, &tls.Config{InsecureSkipVerify: true})
-			return tlsConfigName
+			return "", fmt.Errorf("failed to load client cert: %w", err)
 		}
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caPEM)
-
-		// Load client cert and key if provided
-		tlsConfig := &tls.Config{
-			RootCAs:            caCertPool,
-			ServerName:         "",
-			InsecureSkipVerify: true,
+		keyPEM, err := loadCertFromFile(c.cfg.SSLClientKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to load client key: %w", err)
 		}
-
-		if config.SSLClientCRT != "" && config.SSLClientKey != "" {
-			certPEM, err := loadCertFromFile(config.SSLClientCRT)
-			if err != nil {
-				log.Fatalf("Failed to load client cert: %v", err)
-			}
-			keyPEM, err := loadCertFromFile(config.SSLClientKey)
-			if err != nil {
-				log.Fatalf("Failed to load client key: %v", err)
-			}
-			cert, err := tls.X509KeyPair(certPEM, keyPEM)
-			if err != nil {
-				log.Fatalf("Failed to parse client cert/key: %v", err)
-			}
-			tlsConfig.Certificates = []tls.Certificate{cert}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse client cert/key: %w", err)
 		}
-
-		// Register unique name per config (or use fixed name if single instance)
-		tlsConfigName := fmt.Sprintf("tidb-tls-%s", config.Host) // Unique per host
-		mysql.RegisterTLSConfig(tlsConfigName, tlsConfig)
-		log.Printf("Registered TLS config: %s", tlsConfigName)
-		return tlsConfigName
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
 
-	getClient := func(config model.TiDBConfig) (*sql.DB, error) {
-		log.Printf("Connecting to TiDB at %s:%d (TLS: %v)", config.Host, config.Port, config.TLS)
-
-		// Get or register TLS config
-		tlsConfigName := getTLSConfig(config) // Now returns string
+	tlsConfigName := fmt.Sprintf("tidb-tls-%s", c.cfg.Host) // Unique per host
+	if err := mysql.RegisterTLSConfig(tlsConfigName, tlsConfig); err != nil {
+		return "", err
+	}
+	logf(ctx, "Registered TLS config: %s", tlsConfigName)
+	return tlsConfigName, nil
+}
 
-		// Build base DSN without TLS file paths
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=true&interpolateParams=true",
-			config.Username, config.Password, config.Host, config.Port, config.Database)
+func (c *tidbChecker) Connect(ctx context.Context) error {
+	logf(ctx, "Connecting to TiDB at %s (TLS: %v)", c.Addr(), c.cfg.TLS)
 
-		if config.TLS && tlsConfigName != "" {
-			dsn += fmt.Sprintf("&tls=%s", tlsConfigName)
-		} else if !config.TLS {
-			// Non-TLS connection
-			dsn += "&allowNativePasswords=true"
-		}
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=true&interpolateParams=true",
+		c.cfg.Username, c.cfg.Password, c.Addr(), c.cfg.Database)
 
-		db, err := sql.Open("mysql", dsn)
+	if c.cfg.TLS {
+		tlsConfigName, err := c.registerTLS(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to open TiDB connection: %w", err)
+			return err
 		}
+		dsn += "&tls=" + tlsConfigName
+	} else {
+		// Non-TLS connection
+		dsn += "&allowNativePasswords=true"
+	}
 
-		// Configure connection pool (uncomment if needed)
-		// db.SetMaxIdleConns(5)
-		// db.SetMaxOpenConns(10)
-		// db.SetConnMaxLifetime(time.Hour)
-
-		// Test connection with Ping (more reliable for TLS handshake issues)
-		ctx, cancel := context.WithTimeout(ctx, 10*time.Second) // Add timeout
-		defer cancel()
-		err = db.PingContext(ctx)
-		if err != nil {
-			db.Close()
-			return nil, fmt.Errorf("connection ping failed: %w", err)
-		}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open TiDB connection: %w", err)
+	}
 
-		// Get TiDB version for logging
-		var version string
-		err = db.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version)
-		if err != nil {
-			log.Printf("Warning: Could not retrieve version: %v", err)
-			version = "unknown"
-		}
+	// Test connection with Ping (more reliable for TLS handshake issues)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return fmt.Errorf("connection ping failed: %w", err)
+	}
 
-		log.Printf("✓ Connected to TiDB %s", version)
-		return db, nil
+	// Get TiDB version for logging
+	var version string
+	if err := db.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version); err != nil {
+		logf(ctx, "Warning: Could not retrieve version: %v", err)
+		version = "unknown"
 	}
 
-	// Your TiDB config
+	logf(ctx, "✓ Connected to TiDB %s", version)
+	c.db = db
+	c.version = version
+	return nil
+}
 
-	for i, tidbConfig := range tidbs {
-		fmt.Printf("\n=== Testing TiDB %d: %s:%d ===\n", i+1, tidbConfig.Host, tidbConfig.Port)
+func (c *tidbChecker) Version() string {
+	return c.version
+}
 
-		// Set configuration for testing
-		prefix = tidbConfig.Database + ":"
-		tableName := tidbConfig.TableName
-		if tableName == "" {
-			tableName = "test"
-		}
+func (c *tidbChecker) SetRunID(id string) {
+	c.runID = id
+}
 
-		db, err := getClient(tidbConfig)
-		if err != nil {
-			log.Printf("❌ Failed to create TiDB client: %v", err)
+func (c *tidbChecker) Steps() []Step {
+	return []Step{
+		{Name: "create_table", Title: "Creating table if not exists", Run: c.createTable, Required: true},
+		{Name: "insert", Title: "Creating test keys", Run: c.insert},
+		{Name: "read", Title: "Reading test keys", Run: c.read, Needs: []string{"insert"}},
+		{Name: "update", Title: "Updating test key", Run: c.update, Needs: []string{"insert"}},
+		{Name: "scan", Title: "Scanning test keys", Run: c.scan, Needs: []string{"insert"}},
+	}
+}
+
+func (c *tidbChecker) createTable(ctx context.Context) error {
+	createTableSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (`key` varchar(255) PRIMARY KEY, `value` TEXT)", c.table)
+	if _, err := c.db.ExecContext(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("create table: %w (SQL attempted: %s)", err, createTableSQL)
+	}
+	printf(ctx, "✓ Table %s ready\n", c.table)
+	return nil
+}
+
+func (c *tidbChecker) insert(ctx context.Context) error {
+	c.items = nil // the checker may be reused across runs
+	onTeardown(ctx, "delete_keys", c.deleteKeys(c.runID))
+	var errs []error
+	for _, item := range newTestItems(c.runID) {
+		fullKey := c.keys.add(item.Key)
+		if _, err := c.db.ExecContext(ctx, "INSERT INTO "+c.table+" (`key`, `value`) VALUES (?, ?) ON DUPLICATE KEY UPDATE value = VALUES(value)", fullKey, item.Value); err != nil {
+			errs = append(errs, fmt.Errorf("insert key %s: %w", fullKey, err))
 			continue
 		}
-		defer db.Close()
-
-		// Test keys with prefix
-		baseKey := "test_key"
-		testKeys := []string{"1", "2", "3"}
-		testValues := []string{
-			"Initial value for test key 1",
-			"Initial value for test key 2",
-			"Initial value for test key 3",
-		}
+		c.items = append(c.items, item)
+		printf(ctx, "✓ Key %s inserted with value: %s\n", item.Key, item.Value)
+	}
+	return errors.Join(errs...)
+}
 
-		// 0. CREATE TABLE IF NOT EXISTS
-		fmt.Println("0. Creating table if not exists...")
-		createTableSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`.`%s` (`key` varchar(255) PRIMARY KEY, `value` TEXT)", tidbConfig.Database, tableName)
-		fmt.Print(createTableSQL)
-		_, err = db.ExecContext(ctx, createTableSQL)
+func (c *tidbChecker) get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := c.db.QueryRowContext(ctx, "SELECT value FROM "+c.table+" WHERE `key` = ?", c.keys.add(key)).Scan(&value)
+	return value, err
+}
+
+func (c *tidbChecker) read(ctx context.Context) error {
+	if len(c.items) == 0 {
+		return errNoItems
+	}
+	var errs []error
+	for _, item := range c.items {
+		value, err := c.get(ctx, item.Key)
 		if err != nil {
-			log.Printf("❌ Create table error: %v", err)
-			log.Printf("SQL attempted: %s", createTableSQL)
+			errs = append(errs, fmt.Errorf("get key %s: %w", item.Key, err))
+			continue
+		}
+		if value == "" {
+			errs = append(errs, fmt.Errorf("key %s not found", item.Key))
 			continue
-		} else {
-			fmt.Printf("✓ Table %s.%s ready\n", tidbConfig.Database, tableName)
 		}
+		printf(ctx, "✓ Key %s retrieved: %s\n", item.Key, value)
+	}
+	return errors.Join(errs...)
+}
 
-		// 1. CREATE (Insert) Keys
-		fmt.Println("1. Creating test keys...")
-		testItems := make([]struct{ Key, Value string }, len(testKeys))
+func (c *tidbChecker) update(ctx context.Context) error {
+	updateKey := testKey(c.runID, 1)
+	updatedValue := "Updated value for test key 1 - modified at " + time.Now().Format(time.RFC3339)
 
-		for j, key := range testKeys {
-			fullKey := addPrefix(baseKey + "_" + key)
-			value := testValues[j]
+	if _, err := c.db.ExecContext(ctx, "UPDATE "+c.table+" SET `value` = ? WHERE `key` = ?", updatedValue, c.keys.add(updateKey)); err != nil {
+		return fmt.Errorf("update key %s: %w", updateKey, err)
+	}
+
+	// Verify immediately (TiDB updates synchronously)
+	value, err := c.get(ctx, updateKey)
+	if err != nil || value == "" {
+		return fmt.Errorf("verification failed for updated key %s", updateKey)
+	}
+	printf(ctx, "✓ Key %s updated to: %s\n", updateKey, value)
+	return nil
+}
 
-			_, err = db.ExecContext(ctx, "INSERT INTO "+tidbConfig.Database+"."+tableName+" (`key`, `value`) VALUES (?, ?) ON DUPLICATE KEY UPDATE value = VALUES(value)", fullKey, value)
-			if err != nil {
-				log.Printf("❌ Insert key %s error: %v", fullKey, err)
-				continue
-			}
+func (c *tidbChecker) scan(ctx context.Context) error {
+	if len(c.items) == 0 {
+		return errNoItems
+	}
+	startKey, endKey := c.keys.testRange(c.runID)
 
-			testItems[j] = struct{ Key, Value string }{baseKey + "_" + key, value}
-			fmt.Printf("✓ Key %s inserted with value: %s\n", baseKey+"_"+key, value)
-		}
+	rows, err := c.db.QueryContext(ctx, "SELECT `key`, `value` FROM "+c.table+" WHERE `key` >= ? AND `key` < ? ORDER BY `key` LIMIT 100", startKey, endKey)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-		// 2. READ (Get) Keys
-		fmt.Println("2. Reading test keys...")
-		for _, item := range testItems {
-			if item.Key == "" {
-				continue // Skip if insert failed
-			}
-
-			fullKey := addPrefix(item.Key)
-			var retrievedValue string
-			err = db.QueryRowContext(ctx, "SELECT value FROM "+tidbConfig.Database+"."+tableName+" WHERE `key` = ?", fullKey).Scan(&retrievedValue)
-			if err != nil {
-				log.Printf("❌ Get key %s error: %v", item.Key, err)
-				continue
-			}
-
-			if retrievedValue == "" {
-				log.Printf("❌ Key %s not found", item.Key)
-				continue
-			}
-
-			fmt.Printf("✓ Key %s retrieved: %s\n", item.Key, retrievedValue)
+	count := 0
+	for rows.Next() {
+		var fullKey, value string
+		if err := rows.Scan(&fullKey, &value); err != nil {
+			return err
 		}
+		printf(ctx, "  - %s: %s\n", c.keys.trim(fullKey), value)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	printf(ctx, "✓ Scan found %d keys in range\n", count)
+	return checkScanned(count, c.items)
+}
 
-		// 3. UPDATE Key
-		fmt.Println("3. Updating test key...")
-		updateKey := baseKey + "_1"
-		updatedValue := "Updated value for test key 1 - modified at " + time.Now().Format(time.RFC3339)
+// deleteKeys returns the teardown deleting the test keys of the run.
+func (c *tidbChecker) deleteKeys(runID string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		startKey, endKey := c.keys.testRange(runID)
+		_, err := c.db.ExecContext(ctx, "DELETE FROM "+c.table+" WHERE `key` >= ? AND `key` < ?", startKey, endKey)
+		return err
+	}
+}
 
-		fullUpdateKey := addPrefix(updateKey)
-		_, err = db.ExecContext(ctx, "UPDATE "+tidbConfig.Database+"."+tableName+" SET `value` = ? WHERE `key` = ?", updatedValue, fullUpdateKey)
-		if err != nil {
-			log.Printf("❌ Update key %s error: %v", updateKey, err)
-		} else {
-			// Verify immediately (TiDB updates synchronously)
-			var updatedValueStr string
-			err = db.QueryRowContext(ctx, "SELECT value FROM "+tidbConfig.Database+"."+tableName+" WHERE `key` = ?", fullUpdateKey).Scan(&updatedValueStr)
-			if err == nil && updatedValueStr != "" {
-				fmt.Printf("✓ Key %s updated to: %s\n", updateKey, updatedValueStr)
-			} else {
-				log.Printf("❌ Verification failed for updated key %s", updateKey)
-			}
+// Artifacts lists the test rows in the table, grouped by run. A missing
+// table or database holds none.
+func (c *tidbChecker) Artifacts(ctx context.Context, before time.Time) ([]Artifact, error) {
+	startKey, endKey := c.keys.testRange("")
+	rows, err := c.db.QueryContext(ctx, "SELECT `key` FROM "+c.table+" WHERE `key` >= ? AND `key` < ? ORDER BY `key`", startKey, endKey)
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && (me.Number == 1049 || me.Number == 1146) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list test rows: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
 		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return c.keys.artifacts("rows", keys, before), nil
+}
 
-		// 4. SCAN (Range Query) Test Keys
-		fmt.Println("4. Scanning test keys...")
-		startKey := addPrefix(baseKey + "_")
-		endKey := addPrefix(baseKey + "_z")
+// tidbDeleteBatch is the number of rows deleted per statement when
+// sweeping.
+const tidbDeleteBatch = 500
 
-		rows, err := db.QueryContext(ctx, "SELECT `key`, `value` FROM "+tidbConfig.Database+"."+tableName+" WHERE `key` >= ? AND `key` < ? ORDER BY `key` LIMIT 100", startKey, endKey)
-		if err != nil {
-			log.Printf("❌ Scan error: %v", err)
-		} else {
-			count := 0
-			for rows.Next() {
-				var fullKey, value string
-				if err := rows.Scan(&fullKey, &value); err != nil {
-					break
-				}
-				cleanKey := removePrefix(fullKey)
-				fmt.Printf("  - %s: %s\n", cleanKey, value)
-				count++
-			}
-			fmt.Printf("✓ Scan found %d keys in range\n", count)
-			rows.Close()
+func (c *tidbChecker) Remove(ctx context.Context, a Artifact) error {
+	for batch := range slices.Chunk(a.Keys, tidbDeleteBatch) {
+		args := make([]any, len(batch))
+		for i, key := range batch {
+			args[i] = key
 		}
-
-		// // 5. DELETE Key
-		// fmt.Println("5. Deleting test key...")
-		// deleteKey := baseKey + "_2"
-		// fullDeleteKey := addPrefix(deleteKey)
-
-		// // Verify exists before delete
-		// var exists int
-		// err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+tidbConfig.Database+"."+tableName+" WHERE key = ?", fullDeleteKey).Scan(&exists)
-		// if err != nil || exists == 0 {
-		// 	log.Printf("❌ Key %s not found for deletion", deleteKey)
-		// } else {
-		// 	_, err = db.ExecContext(ctx, "DELETE FROM "+tidbConfig.Database+"."+tableName+" WHERE key = ?", fullDeleteKey)
-		// 	if err != nil {
-		// 		log.Printf("❌ Delete key %s error: %v", deleteKey, err)
-		// 	} else {
-		// 		// Verify immediately
-		// 		var existsAfter int
-		// 		err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+tidbConfig.Database+"."+tableName+" WHERE key = ?", fullDeleteKey).Scan(&existsAfter)
-		// 		if err == nil && existsAfter == 0 {
-		// 			fmt.Printf("✓ Key %s deleted successfully\n", deleteKey)
-		// 		} else {
-		// 			log.Printf("❌ Key %s still exists after deletion", deleteKey)
-		// 		}
-		// 	}
-		// }
-
-		// // 6. CLEANUP - Delete remaining test keys
-		// fmt.Println("6. Cleaning up test keys...")
-		// for _, item := range testItems {
-		// 	if item.Key == "" {
-		// 		continue
-		// 	}
-		// 	// Skip the key we're keeping for final verification (adjust if needed)
-		// 	if strings.Contains(item.Key, "2") {
-		// 		continue
-		// 	}
-
-		// 	fullCleanupKey := addPrefix(item.Key)
-		// 	_, err = db.ExecContext(ctx, "DELETE FROM "+tidbConfig.Database+"."+tableName+" WHERE key = ?", fullCleanupKey)
-		// 	if err != nil {
-		// 		log.Printf("⚠️ Cleanup warning for %s: %v", item.Key, err)
-		// 	}
-		// }
-
-		// Final verification - check one key still exists
-		finalCheckKey := baseKey + "_3"
-		var checkValue string
-		err = db.QueryRowContext(ctx, "SELECT value FROM "+tidbConfig.Database+"."+tableName+" WHERE key = ?", addPrefix(finalCheckKey)).Scan(&checkValue)
-		if err == nil && checkValue != "" {
-			fmt.Printf("✓ Final verification: key %s still exists with value %s\n", finalCheckKey, checkValue)
+		marks := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		if _, err := c.db.ExecContext(ctx, "DELETE FROM "+c.table+" WHERE `key` IN ("+marks+")", args...); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		fmt.Printf("✅ TiDB %d test completed\n", i+1)
+func (c *tidbChecker) Close() error {
+	return c.db.Close()
+}
+
+// tidbTransientErrors are the MySQL and TiDB error numbers caused by load,
+// contention or an unavailable TiKV rather than by the request.
+var tidbTransientErrors = []uint16{
+	1205, // lock wait timeout
+	1213, // deadlock
+	8028, // schema changed during the transaction
+	9001, // PD server timeout
+	9002, // TiKV server timeout
+	9003, // TiKV server busy
+	9005, // region unavailable
+	9007, // write conflict
+}
+
+// Transient retries the errors in tidbTransientErrors and broken
+// connections. Other server errors, such as access denied (1045), are
+// permanent.
+func (c *tidbChecker) Transient(err error) bool {
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		return slices.Contains(tidbTransientErrors, me.Number)
+	}
+	if errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, driver.ErrBadConn) {
+		return true
 	}
+	return transient(err)
 }
@@ -1,223 +1,273 @@
 package service
+
 import (
 	"context"
+	"data-check-all/model"
+	"errors"
 	"fmt"
-	"log"
-	// "net/http"
-	// "errors"
 	"github.com/tikv/client-go/v2/config"
+	tikverr "github.com/tikv/client-go/v2/error"
 	"github.com/tikv/client-go/v2/rawkv"
-	"data-check-all/model"
-	"strings"
 	"time"
 )
-// Test function for TiKV CRUD operations
-func TestTiKV(tikvConfigs []model.TiKVConfig) {
-	ctx := context.Background()
-	prefix := "devops" + ":"
-	addPrefix :=
-		func(key string) string {
-			return prefix + key
-			// return key
-		}
-	removePrefix :=
-		func(key string) string {
-			return strings.TrimPrefix(key, prefix)
-			// return key
-		}
-	getClient := func(pdAddr string, TLS bool, ClusterSSLCA, ClusterSSLCert, ClusterSSLKey string) (*rawkv.Client, error) {
-		log.Printf("Connecting to TiKV at %s (TLS: %v)", pdAddr, TLS)
-		if pdAddr == "" {
-			return nil, fmt.Errorf("URL environment variable not set")
-		}
-		var client *rawkv.Client
-		var err error
-		// ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		// defer cancel()
-		if TLS {
-			client, err = rawkv.NewClient(ctx, []string{pdAddr}, config.Security{
-				ClusterSSLCA:   ClusterSSLCA,
-				ClusterSSLCert: ClusterSSLCert,
-				ClusterSSLKey:  ClusterSSLKey,
-			})
-		} else {
-			client, err = rawkv.NewClient(ctx, []string{pdAddr}, config.DefaultConfig().Security)
-		}
-		if err != nil {
-			log.Printf("Failed to connect to TiKV: %v", err)
-			return nil, fmt.Errorf("failed to connect to TiKV: %w", err)
+
+func init() {
+	Register("tikv", "TiKV", newTiKVChecker)
+}
+
+type tikvChecker struct {
+	cfg     model.TiKVConfig
+	keys    keyspace
+	runID   string
+	client  *rawkv.Client
+	version string
+	items   []model.TestKeyValue // keys inserted successfully
+	// deleteSent is the run whose delete step last sent its request, so a
+	// retry after a timeout accepts the key already gone.
+	deleteSent string
+}
+
+func newTiKVChecker(cfg model.TiKVConfig) Checker {
+	return &tikvChecker{cfg: cfg, keys: keyspace(cfg.Prefix + ":")}
+}
+
+func (c *tikvChecker) Addr() string {
+	return fmt.Sprintf("%s:%d", c.cfg.Host, c.cfg.Port)
+}
+
+func (c *tikvChecker) Connect(ctx context.Context) error {
+	pdAddr := c.Addr()
+	// TLS is used whenever all three certificates are provided
+	security := config.DefaultConfig().Security
+	tls := c.cfg.SSLClientCRT != "" && c.cfg.SSLClientKey != "" && c.cfg.SSLCACRT != ""
+	if tls {
+		security = config.Security{
+			ClusterSSLCA:   c.cfg.SSLCACRT,
+			ClusterSSLCert: c.cfg.SSLClientCRT,
+			ClusterSSLKey:  c.cfg.SSLClientKey,
 		}
-		return client, nil
+	}
+	logf(ctx, "Connecting to TiKV at %s (TLS: %v)", pdAddr, tls)
+
+	client, err := newRawKVClient(ctx, pdAddr, security)
+	if err != nil {
+		return fmt.Errorf("failed to connect to TiKV: %w", err)
+	}
+	c.client = client
 
+	// rawkv has no version call; report the version of the first store
+	if stores, err := client.GetPDClient().GetAllStores(ctx); err == nil && len(stores) > 0 {
+		c.version = stores[0].GetVersion()
 	}
+	return nil
+}
 
-	for i, tikvConfig := range tikvConfigs {
-		fmt.Printf("\n=== Testing TiKV %d: %s:%d ===\n", i+1, tikvConfig.Host, tikvConfig.Port)
+func (c *tikvChecker) Version() string {
+	return c.version
+}
 
-		// Set PD address for testing
-		pdAddr := fmt.Sprintf("%s:%d", tikvConfig.Host, tikvConfig.Port)
-		prefix = tikvConfig.Prefix + ":"
-		TLS := true // Enable TLS for testing if certificates are provided
+func (c *tikvChecker) SetRunID(id string) {
+	c.runID = id
+}
 
-		ClusterSSLCert := ""
-		ClusterSSLKey := ""
-		ClusterSSLCA := ""
+func (c *tikvChecker) Steps() []Step {
+	return []Step{
+		{Name: "insert", Title: "Creating test keys", Run: c.insert},
+		{Name: "read", Title: "Reading test keys", Run: c.read, Needs: []string{"insert"}},
+		{Name: "update", Title: "Updating test key", Run: c.update, Needs: []string{"insert"}},
+		{Name: "scan", Title: "Scanning test keys", Run: c.scan, Needs: []string{"insert"}},
+		{Name: "delete", Title: "Deleting test key", Run: c.delete, Needs: []string{"insert"}},
+	}
+}
 
-		if tikvConfig.SSLClientCRT != "" && tikvConfig.SSLClientKey != "" && tikvConfig.SSLCACRT != "" {
-			ClusterSSLCert = tikvConfig.SSLClientCRT
-			ClusterSSLKey = tikvConfig.SSLClientKey
-			ClusterSSLCA = tikvConfig.SSLCACRT
+func (c *tikvChecker) insert(ctx context.Context) error {
+	c.items = nil // the checker may be reused across runs
+	onTeardown(ctx, "delete_keys", c.deleteKeys(c.runID))
+	var errs []error
+	for _, item := range newTestItems(c.runID) {
+		if err := c.client.Put(ctx, []byte(c.keys.add(item.Key)), []byte(item.Value)); err != nil {
+			errs = append(errs, fmt.Errorf("insert key %s: %w", item.Key, err))
+			continue
 		}
+		c.items = append(c.items, item)
+		printf(ctx, "✓ Key %s inserted with value: %s\n", item.Key, item.Value)
+	}
+	return errors.Join(errs...)
+}
 
-		client, err := getClient(pdAddr, TLS, ClusterSSLCA, ClusterSSLCert, ClusterSSLKey)
+func (c *tikvChecker) read(ctx context.Context) error {
+	if len(c.items) == 0 {
+		return errNoItems
+	}
+	var errs []error
+	for _, item := range c.items {
+		value, err := c.client.Get(ctx, []byte(c.keys.add(item.Key)))
 		if err != nil {
-			log.Printf("❌ Failed to create TiKV client: %v", err)
+			errs = append(errs, fmt.Errorf("get key %s: %w", item.Key, err))
 			continue
 		}
-		defer client.Close()
-
-		// Test keys with prefix
-		baseKey := "test_key"
-		testKeys := []string{"1", "2", "3"}
-		testValues := []string{
-			"Initial value for test key 1",
-			"Initial value for test key 2",
-			"Initial value for test key 3",
+		if value == nil {
+			errs = append(errs, fmt.Errorf("key %s not found", item.Key))
+			continue
 		}
+		printf(ctx, "✓ Key %s retrieved: %s\n", item.Key, string(value))
+	}
+	return errors.Join(errs...)
+}
 
-		// 1. CREATE (Insert) Keys
-		fmt.Println("1. Creating test keys...")
-		testItems := make([]model.TestKeyValue, len(testKeys))
+func (c *tikvChecker) update(ctx context.Context) error {
+	updateKey := testKey(c.runID, 1)
+	updatedValue := "Updated value for test key 1 - modified at " + time.Now().Format(time.RFC3339)
 
-		for j, key := range testKeys {
-			fullKey := addPrefix(baseKey + "_" + key)
-			value := testValues[j]
+	fullKey := []byte(c.keys.add(updateKey))
+	if err := c.client.Put(ctx, fullKey, []byte(updatedValue)); err != nil {
+		return fmt.Errorf("update key %s: %w", updateKey, err)
+	}
 
-			err = client.Put(ctx, []byte(fullKey), []byte(value))
-			if err != nil {
-				log.Printf("❌ Insert key %s error: %v", fullKey, err)
-				continue
-			}
+	// Verify update
+	value, err := c.client.Get(ctx, fullKey)
+	if err != nil || value == nil {
+		return fmt.Errorf("verification failed for updated key %s", updateKey)
+	}
+	printf(ctx, "✓ Key %s updated to: %s\n", updateKey, string(value))
+	return nil
+}
 
-			testItems[j] = model.TestKeyValue{
-				Key:   baseKey + "_" + key,
-				Value: value,
-				Ts:    time.Now(),
-			}
-			fmt.Printf("✓ Key %s inserted with value: %s\n", baseKey+"_"+key, value)
+func (c *tikvChecker) scan(ctx context.Context) error {
+	if len(c.items) == 0 {
+		return errNoItems
+	}
+	startKey, endKey := c.keys.testRange(c.runID)
+
+	keys, values, err := c.client.Scan(ctx, []byte(startKey), []byte(endKey), 100)
+	if err != nil {
+		return err
+	}
+	printf(ctx, "✓ Scan found %d keys in range\n", len(keys))
+	for j, key := range keys {
+		if j >= len(values) {
+			break
 		}
+		printf(ctx, "  - %s: %s\n", c.keys.trim(string(key)), string(values[j]))
+	}
+	return checkScanned(len(keys), c.items)
+}
 
-		// 2. READ (Get) Keys
-		fmt.Println("2. Reading test keys...")
-		for _, item := range testItems {
-			if item.Key == "" {
-				continue // Skip if insert failed
-			}
+func (c *tikvChecker) delete(ctx context.Context) error {
+	deleteKey := testKey(c.runID, 2)
+	fullKey := []byte(c.keys.add(deleteKey))
+	retry := c.deleteSent == c.runID
+	c.deleteSent = c.runID
 
-			fullKey := addPrefix(item.Key)
-			valueBytes, err := client.Get(ctx, []byte(fullKey))
-			if err != nil {
-				log.Printf("❌ Get key %s error: %v", item.Key, err)
-				continue
-			}
+	// Verify exists before delete, unless an attempt that timed out may
+	// have deleted it already
+	value, err := c.client.Get(ctx, fullKey)
+	if err != nil || value == nil && !retry {
+		return fmt.Errorf("key %s not found for deletion", deleteKey)
+	}
+	if err := c.client.Delete(ctx, fullKey); err != nil {
+		return fmt.Errorf("delete key %s: %w", deleteKey, err)
+	}
 
-			if valueBytes == nil {
-				log.Printf("❌ Key %s not found", item.Key)
-				continue
-			}
+	// Verify deletion
+	if after, _ := c.client.Get(ctx, fullKey); after != nil {
+		return fmt.Errorf("key %s still exists after deletion", deleteKey)
+	}
+	printf(ctx, "✓ Key %s deleted successfully\n", deleteKey)
+	return nil
+}
 
-			retrievedValue := string(valueBytes)
-			fmt.Printf("✓ Key %s retrieved: %s\n", item.Key, retrievedValue)
-		}
+// deleteKeys returns the teardown deleting the test keys of the run.
+func (c *tikvChecker) deleteKeys(runID string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		startKey, endKey := c.keys.testRange(runID)
+		return c.client.DeleteRange(ctx, []byte(startKey), []byte(endKey))
+	}
+}
 
-		// 3. UPDATE Key
-		fmt.Println("3. Updating test key...")
-		updateKey := baseKey + "_1"
-		updatedValue := "Updated value for test key 1 - modified at " + time.Now().Format(time.RFC3339)
+// tikvScanBatch is the number of keys fetched per scan when sweeping.
+const tikvScanBatch = 1000
 
-		fullUpdateKey := addPrefix(updateKey)
-		err = client.Put(ctx, []byte(fullUpdateKey), []byte(updatedValue))
+// Artifacts lists the test keys under the prefix, grouped by run.
+func (c *tikvChecker) Artifacts(ctx context.Context, before time.Time) ([]Artifact, error) {
+	start, end := c.keys.testRange("")
+	var keys []string
+	for {
+		batch, _, err := c.client.Scan(ctx, []byte(start), []byte(end), tikvScanBatch, rawkv.ScanKeyOnly())
 		if err != nil {
-			log.Printf("❌ Update key %s error: %v", updateKey, err)
-		} else {
-			// Verify update
-			updatedBytes, err := client.Get(ctx, []byte(fullUpdateKey))
-			if err == nil && updatedBytes != nil {
-				fmt.Printf("✓ Key %s updated to: %s\n", updateKey, string(updatedBytes))
-			} else {
-				log.Printf("❌ Verification failed for updated key %s", updateKey)
-			}
+			return nil, fmt.Errorf("scan test keys: %w", err)
 		}
+		for _, key := range batch {
+			keys = append(keys, string(key))
+		}
+		if len(batch) < tikvScanBatch {
+			return c.keys.artifacts("keys", keys, before), nil
+		}
+		start = string(batch[len(batch)-1]) + "\x00"
+	}
+}
 
-		// 4. SCAN (Range Query) Test Keys
-		fmt.Println("4. Scanning test keys...")
-		startKey := addPrefix(baseKey + "_")
-		endKey := addPrefix(baseKey + "_z") // End key for scan range
+func (c *tikvChecker) Remove(ctx context.Context, a Artifact) error {
+	keys := make([][]byte, len(a.Keys))
+	for i, key := range a.Keys {
+		keys[i] = []byte(key)
+	}
+	return c.client.BatchDelete(ctx, keys)
+}
 
-		keys, values, err := client.Scan(ctx, []byte(startKey), []byte(endKey), 100)
-		if err != nil {
-			log.Printf("❌ Scan error: %v", err)
-		} else {
-			fmt.Printf("✓ Scan found %d keys in range\n", len(keys))
-			for j, key := range keys {
-				if j >= len(values) {
-					break
-				}
-				cleanKey := removePrefix(string(key))
-				fmt.Printf("  - %s: %s\n", cleanKey, string(values[j]))
-			}
-		}
+func (c *tikvChecker) Close() error {
+	return c.client.Close()
+}
 
-		// 5. DELETE Key
-		fmt.Println("5. Deleting test key...")
-		deleteKey := baseKey + "_2"
-		fullDeleteKey := addPrefix(deleteKey)
-
-		// Verify exists before delete
-		existsValue, err := client.Get(ctx, []byte(fullDeleteKey))
-		if err != nil || existsValue == nil {
-			log.Printf("❌ Key %s not found for deletion", deleteKey)
-		} else {
-			err = client.Delete(ctx, []byte(fullDeleteKey))
-			if err != nil {
-				log.Printf("❌ Delete key %s error: %v", deleteKey, err)
-			} else {
-				// Verify deletion
-				afterDelete, _ := client.Get(ctx, []byte(fullDeleteKey))
-				if afterDelete == nil {
-					fmt.Printf("✓ Key %s deleted successfully\n", deleteKey)
-				} else {
-					log.Printf("❌ Key %s still exists after deletion", deleteKey)
-				}
-			}
-		}
+// newRawKVClient is rawkv.NewClient bounded by ctx, which the PD client
+// ignores while it retries an unreachable PD. A client that connects after
+// ctx is done is closed.
+func newRawKVClient(ctx context.Context, pdAddr string, security config.Security) (*rawkv.Client, error) {
+	type result struct {
+		client *rawkv.Client
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		client, err := rawkv.NewClient(ctx, []string{pdAddr}, security)
+		done <- result{client, err}
+	}()
 
-		// 6. CLEANUP - Delete remaining test keys
-		fmt.Println("6. Cleaning up test keys...")
-		for _, item := range testItems {
-			if item.Key == "" {
-				continue
-			}
-			// Skip the key we're keeping for final verification
-			if strings.Contains(item.Key, "2") {
-				continue
+	select {
+	case r := <-done:
+		return r.client, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.client != nil {
+				r.client.Close()
 			}
+		}()
+		return nil, ctx.Err()
+	}
+}
 
-			fullCleanupKey := addPrefix(item.Key)
-			err = client.Delete(ctx, []byte(fullCleanupKey))
-			if err != nil {
-				log.Printf("⚠️ Cleanup warning for %s: %v", item.Key, err)
-			}
-		}
+// tikvTransientErrors are the client errors of a region or store that is
+// busy, moving or briefly unavailable.
+var tikvTransientErrors = []error{
+	tikverr.ErrRegionUnavailable,
+	tikverr.ErrRegionDataNotReady,
+	tikverr.ErrRegionNotInitialized,
+	tikverr.ErrRegionRecoveryInProgress,
+	tikverr.ErrTiKVServerTimeout,
+	tikverr.ErrTiKVServerBusy,
+	tikverr.ErrTiKVStaleCommand,
+}
 
-		// Final verification - check one key still exists
-		finalCheckKey := baseKey + "_3"
-		checkValue, err := client.Get(ctx, []byte(addPrefix(finalCheckKey)))
-		if err == nil && checkValue != nil {
-			fmt.Printf("✓ Final verification: key %s still exists with value %s\n", finalCheckKey, string(checkValue))
+// Transient retries region and store errors, and PD timeouts.
+func (c *tikvChecker) Transient(err error) bool {
+	for _, e := range tikvTransientErrors {
+		if errors.Is(err, e) {
+			return true
 		}
-
-		fmt.Printf("✅ TiKV %d test completed\n", i+1)
 	}
-
+	var pdTimeout *tikverr.ErrPDServerTimeout
+	if errors.As(err, &pdTimeout) {
+		return true
+	}
+	return transient(err)
 }
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"data-check-all/model"
+	"errors"
+	"fmt"
+	"go.yaml.in/yaml/v4"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ConfigError is a problem at a position in the config file.
+type ConfigError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ErrorAt returns a ConfigError at the position of node.
+func ErrorAt(node *yaml.Node, format string, args ...any) error {
+	return &ConfigError{Line: node.Line, Column: node.Column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// DecodeErrors splits an error from decoding YAML into one ConfigError
+// per value that could not be decoded.
+func DecodeErrors(err error) []error {
+	var te *yaml.TypeError
+	if !errors.As(err, &te) {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range te.Errors {
+		errs = append(errs, &ConfigError{Line: e.Line, Column: e.Column, Msg: e.Err.Error()})
+	}
+	return errs
+}
+
+// CheckKeys reports every key in node that has no field in t, the type node
+// is decoded into, however deeply nested. Keys left to an inline map of t
+// are accepted when listed in mapKeys, or always when mapKeys is empty.
+func CheckKeys(node *yaml.Node, t reflect.Type, mapKeys ...string) []error {
+	var errs []error
+	switch t.Kind() {
+	case reflect.Pointer:
+		return CheckKeys(node, t.Elem())
+	case reflect.Slice:
+		if node.Kind == yaml.SequenceNode {
+			for _, item := range node.Content {
+				errs = append(errs, CheckKeys(item, t.Elem())...)
+			}
+		}
+	case reflect.Map:
+		if node.Kind == yaml.MappingNode {
+			for i := 1; i < len(node.Content); i += 2 {
+				errs = append(errs, CheckKeys(node.Content[i], t.Elem())...)
+			}
+		}
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode || t == reflect.TypeFor[yaml.Node]() {
+			break
+		}
+		fields, open := yamlFields(t)
+		for i := 0; i < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			ft, ok := fields[key.Value]
+			switch {
+			case ok:
+				errs = append(errs, CheckKeys(value, ft)...)
+			case open && (len(mapKeys) == 0 || slices.Contains(mapKeys, key.Value)):
+			default:
+				errs = append(errs, ErrorAt(key, "unknown key %q", key.Value))
+			}
+		}
+	}
+	return errs
+}
+
+// yamlFields returns the types of the fields of struct t by YAML key,
+// including those of inline structs. open is true when t has an inline map
+// and so accepts any key.
+func yamlFields(t reflect.Type) (fields map[string]reflect.Type, open bool) {
+	fields = make(map[string]reflect.Type)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous { // yaml decodes embedded structs of any type
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			if f.Type.Kind() == reflect.Map {
+				open = true
+				continue
+			}
+			inner, innerOpen := yamlFields(f.Type)
+			for k, v := range inner {
+				fields[k] = v
+			}
+			open = open || innerOpen
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields, open
+}
+
+// checkFields turns the problems found in a decoded target config into
+// errors at the position of each field in node, or of node when the field
+// is missing.
+func checkFields(node *yaml.Node, cfg any) []error {
+	c, ok := cfg.(interface{ Check() []model.FieldError })
+	if !ok {
+		return nil
+	}
+	var errs []error
+	for _, fe := range c.Check() {
+		at := node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == fe.Field {
+				at = node.Content[i+1]
+			}
+		}
+		errs = append(errs, ErrorAt(at, "%s", fe))
+	}
+	return errs
+}
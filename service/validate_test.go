@@ -0,0 +1,145 @@
+package service
+
+import (
+	"data-check-all/model"
+	"go.yaml.in/yaml/v4"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+type testInner struct {
+	Port int `yaml:"port"`
+}
+
+type testCommon struct {
+	Labels map[string]string `yaml:"labels"`
+}
+
+type testConfig struct {
+	Name       string                `yaml:"name"`
+	Inner      *testInner            `yaml:"inner"`
+	List       []testInner           `yaml:"list"`
+	ByName     map[string]*testInner `yaml:"by_name"`
+	Skip       string                `yaml:"-"`
+	Plain      string
+	testCommon `yaml:",inline"`
+}
+
+type testOpen struct {
+	Name string               `yaml:"name"`
+	Rest map[string]yaml.Node `yaml:",inline"`
+}
+
+// parse returns the root mapping of src.
+func parse(t *testing.T, src string) *yaml.Node {
+	t.Helper()
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc.Content[0]
+}
+
+func errorStrings(errs []error) []string {
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	return got
+}
+
+func TestCheckKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		typ     reflect.Type
+		mapKeys []string
+		want    []string
+	}{
+		{
+			name: "known keys",
+			src:  "name: x\nplain: y\ninner:\n  port: 1\nlist:\n  - port: 2\nby_name:\n  a:\n    port: 3\nlabels:\n  env: prod",
+			typ:  reflect.TypeFor[testConfig](),
+		},
+		{
+			name: "unknown top-level key",
+			src:  "name: x\nnmae: y",
+			typ:  reflect.TypeFor[testConfig](),
+			want: []string{`2:1: unknown key "nmae"`},
+		},
+		{
+			name: "unknown key behind a pointer",
+			src:  "inner:\n  prot: 1",
+			typ:  reflect.TypeFor[*testConfig](),
+			want: []string{`2:3: unknown key "prot"`},
+		},
+		{
+			name: "unknown keys in a list and a map",
+			src:  "list:\n  - port: 1\n  - pot: 2\nby_name:\n  a:\n    por: 3",
+			typ:  reflect.TypeFor[testConfig](),
+			want: []string{`3:5: unknown key "pot"`, `6:5: unknown key "por"`},
+		},
+		{
+			name: "ignored field",
+			src:  "skip: x",
+			typ:  reflect.TypeFor[testConfig](),
+			want: []string{`1:1: unknown key "skip"`},
+		},
+		{
+			name: "inline map takes any key",
+			src:  "name: x\nanything: y",
+			typ:  reflect.TypeFor[testOpen](),
+		},
+		{
+			name:    "inline map takes only the listed keys",
+			src:     "tidb: []\ntdib: []",
+			typ:     reflect.TypeFor[testOpen](),
+			mapKeys: []string{"tidb"},
+			want:    []string{`2:1: unknown key "tdib"`},
+		},
+		{
+			name: "scalar where a mapping belongs",
+			src:  "inner: 5",
+			typ:  reflect.TypeFor[testConfig](),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := errorStrings(CheckKeys(parse(t, tt.src), tt.typ, tt.mapKeys...))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	root := parse(t, "name: x\ninner:\n  port: abc\nlist:\n  - port: [1]")
+	var cfg testConfig
+	got := errorStrings(DecodeErrors(root.Decode(&cfg)))
+	if len(got) != 2 || got[0][:4] != "3:9:" || got[1][:5] != "5:11:" {
+		t.Errorf("got %q, want errors at 3:9 and 5:11", got)
+	}
+	if cfg.Name != "x" {
+		t.Errorf("name = %q, want the fields around the bad ones decoded", cfg.Name)
+	}
+}
+
+func TestCheckFields(t *testing.T) {
+	entry := parse(t, "host: db.local\nport: 0\ntls: true\nssl_client_crt: /nonexistent/client.crt")
+	var cfg model.TiDBConfig
+	if err := entry.Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	got := errorStrings(checkFields(entry, cfg))
+	if len(got) < 2 {
+		t.Fatalf("got %q, want the port and the certificates reported", got)
+	}
+	if got[0][:4] != "2:7:" {
+		t.Errorf("got %q, want the port reported at its value, 2:7", got[0])
+	}
+	if !slices.ContainsFunc(got, func(s string) bool { return s[:4] == "1:1:" }) {
+		t.Errorf("got %q, want the missing ssl_client_key reported at the entry, 1:1", got)
+	}
+}